@@ -0,0 +1,493 @@
+package querydigest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Report struct {
+	// Summaries are sorted by the requested SortOrder and truncated to the requested limit.
+	Summaries       []*SlowQuerySummary
+	TotalQueryTime  float64
+	TotalQueryCount int
+	// UniqueQueries is the number of digests before the limit was applied.
+	UniqueQueries int
+	// ParseErrors lists the entries skipped because their header was malformed.
+	ParseErrors []*ParseError
+	// Unparsed are the digested queries the SQL parser did not normalize, per
+	// reason. It is empty with FingerprintLexical, which does not parse.
+	Unparsed []*UnparsedQueries
+	Since    time.Time
+	Until    time.Time
+	// Overall aggregates every digested event, regardless of the limit.
+	Overall *SlowQuerySummary
+	GroupBy GroupBy
+	// Windows are the digests per time window in the order of time, when requested by WithWindow.
+	Windows []*Window
+}
+
+type Option func(*options)
+
+type options struct {
+	concurrency int
+	sortOrder   SortOrder
+	limit       int
+	filters     []Filter
+	groupBy     GroupBy
+	interval    time.Duration
+	onReport    func(*Report)
+	window      time.Duration
+	series      time.Duration
+	percentiles Percentiles
+	bounds      HistogramBounds
+	fingerprint FingerprintMode
+	normalizer  Normalizer
+	summarizer  *Summarizer
+}
+
+func WithConcurrency(n int) Option {
+	return func(o *options) {
+		o.concurrency = n
+	}
+}
+
+// WithSortKey sorts the summaries by key in descending order.
+func WithSortKey(key SortKey) Option {
+	return WithSortOrder(SortOrder{Key: key})
+}
+
+func WithSortOrder(order SortOrder) Option {
+	return func(o *options) {
+		o.sortOrder = order
+	}
+}
+
+// WithLimit keeps only the top n summaries. Zero means no limit.
+func WithLimit(n int) Option {
+	return func(o *options) {
+		o.limit = n
+	}
+}
+
+// WithFilter drops the events which do not match f before they are aggregated.
+// When given multiple times, all filters must match.
+func WithFilter(f Filter) Option {
+	return func(o *options) {
+		o.filters = append(o.filters, f)
+	}
+}
+
+// WithGroupBy aggregates the events by the given dimensions instead of the normalized query.
+func WithGroupBy(groupBy GroupBy) Option {
+	return func(o *options) {
+		o.groupBy = groupBy
+	}
+}
+
+// WithReportInterval calls fn with the digest of the events collected so far
+// every interval while the log is analyzed, e.g. to watch a log read with Follow.
+// The interim reports have no ParseErrors.
+func WithReportInterval(interval time.Duration, fn func(*Report)) Option {
+	return func(o *options) {
+		o.interval = interval
+		o.onReport = fn
+	}
+}
+
+// WithWindow additionally digests the events per time window of the given size, e.g. 5 minutes,
+// reported in Report.Windows. The summaries of each window are sorted and limited like the report.
+func WithWindow(size time.Duration) Option {
+	return func(o *options) {
+		o.window = size
+	}
+}
+
+// WithTimeSeries adds a time series of the calls, total time and p95 per bucket
+// of the given size to each reported summary, see SlowQuerySummary.TimeSeries.
+// Logs spanning more than 1440 buckets are reported in wider buckets.
+func WithTimeSeries(bucket time.Duration) Option {
+	return func(o *options) {
+		o.series = bucket
+	}
+}
+
+// WithPercentiles sets the percentiles computed in the stats, DefaultPercentiles by default.
+func WithPercentiles(ps Percentiles) Option {
+	return func(o *options) {
+		o.percentiles = ps
+	}
+}
+
+// WithHistogramBounds sets the bins of the Query_time histograms, DecadeBounds by default.
+func WithHistogramBounds(b HistogramBounds) Option {
+	return func(o *options) {
+		o.bounds = b
+	}
+}
+
+// WithFingerprint selects how the queries are normalized, FingerprintAST by default.
+func WithFingerprint(mode FingerprintMode) Option {
+	return func(o *options) {
+		o.fingerprint = mode
+	}
+}
+
+// WithNormalizer configures how the SQL parser normalizes the queries with
+// FingerprintAST. It does not apply to LexicalFingerprint.
+func WithNormalizer(n Normalizer) Option {
+	return func(o *options) {
+		o.normalizer = n
+	}
+}
+
+// WithSummarizer collects the events into s instead of a new Summarizer, e.g. to
+// save it with WriteSnapshot afterwards. The dimensions s is grouped by take
+// precedence over WithGroupBy.
+func WithSummarizer(s *Summarizer) Option {
+	return func(o *options) {
+		o.summarizer = s
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		concurrency: runtime.GOMAXPROCS(0),
+		sortOrder:   SortOrder{Key: SortByTotalTime},
+		groupBy:     defaultGroupBy,
+		fingerprint: FingerprintAST,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Source is a named slow query log.
+type Source struct {
+	// Name identifies the log in SlowQueryInfo.Source and ParseError.Source, e.g. its path.
+	Name   string
+	Reader io.Reader
+}
+
+// Analyze reads a slow query log from r and returns its digest.
+// Compressed logs are decompressed transparently, see Decompress.
+func Analyze(ctx context.Context, r io.Reader, opts ...Option) (*Report, error) {
+	return AnalyzeSources(ctx, []Source{{Reader: r}}, opts...)
+}
+
+// AnalyzeSources reads the slow query logs in order and returns the digest of all of their events.
+func AnalyzeSources(ctx context.Context, sources []Source, opts ...Option) (*Report, error) {
+	o := newOptions(opts)
+	a := &analyzer{
+		opts:       o,
+		summarizer: o.summarizer,
+	}
+	if a.summarizer == nil {
+		a.summarizer = NewGroupedSummarizer(o.groupBy)
+	} else {
+		o.groupBy = a.summarizer.GroupBy()
+	}
+	if o.series > 0 {
+		a.summarizer.TrackTimeSeries(o.series)
+	}
+	if o.bounds != nil {
+		a.summarizer.SetHistogramBounds(o.bounds)
+	}
+	if o.percentiles != nil {
+		a.summarizer.SetPercentiles(o.percentiles)
+	}
+	if o.window > 0 {
+		a.windowed = NewWindowedSummarizer(o.window, o.groupBy, a.addWindow)
+		a.windowed.SetPercentiles(o.percentiles)
+		a.windowed.SetHistogramBounds(a.summarizer.histogramBounds)
+	}
+
+	if o.interval > 0 && o.onReport != nil {
+		stop := a.reportEvery(o.interval, o.onReport)
+		defer stop()
+	}
+
+	var parseErrs []*ParseError
+	var err error
+	if a.opts.concurrency > 1 {
+		parseErrs, err = a.analyzeParallel(ctx, sources)
+	} else {
+		parseErrs, err = a.analyze(ctx, sources)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if a.windowed != nil {
+		a.windowed.Flush()
+	}
+
+	return a.report(parseErrs), nil
+}
+
+type analyzer struct {
+	opts       *options
+	summarizer *Summarizer
+	unparsed   unparsedCollector
+	windowed   *WindowedSummarizer
+	windowMu   sync.Mutex
+	windows    []*Window
+}
+
+func (a *analyzer) process(s *SlowQueryInfo) {
+	for _, f := range a.opts.filters {
+		if !f.Match(s) {
+			return
+		}
+	}
+	var tables *[]string
+	if a.opts.groupBy.has(DimensionTable) {
+		s.Tables = s.Tables[:0]
+		tables = &s.Tables
+	}
+	s.ParsedQuery = a.fingerprint(s, tables)
+	a.summarizer.Collect(s)
+	if a.windowed != nil {
+		a.windowed.Collect(s)
+	}
+}
+
+// fingerprint normalizes the query of s by the requested FingerprintMode,
+// recording the queries the parser does not normalize and falling back to
+// LexicalFingerprint when they could not be tokenized.
+func (a *analyzer) fingerprint(s *SlowQueryInfo, tables *[]string) string {
+	if a.opts.fingerprint == FingerprintLexical {
+		return LexicalFingerprint(s.RawQuery)
+	}
+	res, reason, err := a.opts.normalizer.normalize(s.RawQuery, tables)
+	if err == nil {
+		return res
+	}
+	a.unparsed.add(reason, s, err)
+	if res != "" {
+		return res
+	}
+	if tables != nil {
+		*tables = (*tables)[:0]
+	}
+	return LexicalFingerprint(s.RawQuery)
+}
+
+// addWindow records an emitted window, merging a window emitted again because of late events.
+func (a *analyzer) addWindow(w *Window) {
+	a.windowMu.Lock()
+	defer a.windowMu.Unlock()
+
+	for i, prev := range a.windows {
+		if prev.Start.Equal(w.Start) {
+			a.windows[i] = mergeWindows(prev, w, a.opts.percentiles)
+			return
+		}
+	}
+	a.windows = append(a.windows, w)
+	sort.SliceStable(a.windows, func(i, j int) bool {
+		return a.windows[i].Start.Before(a.windows[j].Start)
+	})
+}
+
+// mergeWindows returns a new window so that reports already holding w1 are not affected.
+func mergeWindows(w1, w2 *Window, ps Percentiles) *Window {
+	merged := &Window{
+		Start:           w1.Start,
+		End:             w1.End,
+		TotalQueryTime:  w1.TotalQueryTime + w2.TotalQueryTime,
+		TotalQueryCount: w1.TotalQueryCount + w2.TotalQueryCount,
+	}
+	byChecksum := make(map[uint64]int, len(w1.Summaries))
+	for _, s := range w1.Summaries {
+		byChecksum[s.Checksum] = len(merged.Summaries)
+		merged.Summaries = append(merged.Summaries, s)
+	}
+	for _, s := range w2.Summaries {
+		i, ok := byChecksum[s.Checksum]
+		if !ok {
+			merged.Summaries = append(merged.Summaries, s)
+			continue
+		}
+		m := merged.Summaries[i].snapshot()
+		m.merge(s)
+		m.ComputeHistogram()
+		m.ComputeStatsWithPercentiles(ps)
+		merged.Summaries[i] = m
+	}
+	merged.UniqueQueries = len(merged.Summaries)
+	return merged
+}
+
+func (a *analyzer) analyze(ctx context.Context, sources []Source) ([]*ParseError, error) {
+	var parseErrs []*ParseError
+	for _, src := range sources {
+		errs, err := scanSource(ctx, src, func(s *SlowQueryInfo) bool {
+			a.process(s)
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		parseErrs = append(parseErrs, errs...)
+	}
+	return parseErrs, nil
+}
+
+func (a *analyzer) analyzeParallel(ctx context.Context, sources []Source) ([]*ParseError, error) {
+	parsequeue := make(chan *SlowQueryInfo, 500)
+	var parseErrs []*ParseError
+	errc := make(chan error, 1)
+	go func() {
+		var err error
+		parseErrs, err = parseRawFiles(ctx, sources, parsequeue)
+		errc <- err
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < a.opts.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range parsequeue {
+				a.process(s)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+	return parseErrs, nil
+}
+
+func parseRawFiles(ctx context.Context, sources []Source, parsequeue chan *SlowQueryInfo) ([]*ParseError, error) {
+	defer close(parsequeue)
+
+	var parseErrs []*ParseError
+	for _, src := range sources {
+		errs, err := scanSource(ctx, src, func(s *SlowQueryInfo) bool {
+			select {
+			case parsequeue <- s.clone():
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		parseErrs = append(parseErrs, errs...)
+	}
+	return parseErrs, nil
+}
+
+// scanSource calls fn with every entry of src until fn returns false.
+// The entry passed to fn is only valid until fn returns.
+func scanSource(ctx context.Context, src Source, fn func(*SlowQueryInfo) bool) ([]*ParseError, error) {
+	r, err := Decompress(src.Reader)
+	if err != nil {
+		return nil, src.wrap(fmt.Errorf("decompress: %w", err))
+	}
+	defer r.Close()
+
+	slowQueryScanner := NewSlowQueryScanner(r)
+	for i := 0; slowQueryScanner.Next(); i++ {
+		if i%1024 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		info := slowQueryScanner.SlowQueryInfo()
+		info.Source = src.Name
+		if !fn(info) {
+			return nil, ctx.Err()
+		}
+	}
+	if err := slowQueryScanner.Err(); err != nil {
+		return nil, src.wrap(fmt.Errorf("slowQueryScanner: %w", err))
+	}
+	parseErrs := slowQueryScanner.ParseErrors()
+	for _, e := range parseErrs {
+		e.Source = src.Name
+	}
+	return parseErrs, nil
+}
+
+func (s Source) wrap(err error) error {
+	if s.Name == "" {
+		return err
+	}
+	return fmt.Errorf("%s: %w", s.Name, err)
+}
+
+// reportEvery calls fn with an interim report every interval until stop is called.
+func (a *analyzer) reportEvery(interval time.Duration, fn func(*Report)) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				fn(a.report(nil))
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+func (a *analyzer) report(parseErrs []*ParseError) *Report {
+	summaries := a.summarizer.summarizeWithPercentiles(a.opts.percentiles)
+	sortSummaries(summaries, a.opts.sortOrder)
+
+	unique := len(summaries)
+	if a.opts.limit > 0 && a.opts.limit < len(summaries) {
+		summaries = summaries[:a.opts.limit]
+	}
+
+	since, until := a.summarizer.TimeRange()
+	for _, s := range summaries {
+		s.ComputeTimeSeries(since, until)
+	}
+
+	a.windowMu.Lock()
+	windows := make([]*Window, 0, len(a.windows))
+	for _, w := range a.windows {
+		c := *w
+		c.Summaries = append([]*SlowQuerySummary(nil), w.Summaries...)
+		sortSummaries(c.Summaries, a.opts.sortOrder)
+		if a.opts.limit > 0 && a.opts.limit < len(c.Summaries) {
+			c.Summaries = c.Summaries[:a.opts.limit]
+		}
+		windows = append(windows, &c)
+	}
+	a.windowMu.Unlock()
+
+	return &Report{
+		Summaries:       summaries,
+		TotalQueryTime:  a.summarizer.TotalQueryTime(),
+		TotalQueryCount: a.summarizer.TotalQueryCount(),
+		UniqueQueries:   unique,
+		ParseErrors:     parseErrs,
+		Unparsed:        a.unparsed.queries(),
+		Since:           since,
+		Until:           until,
+		Overall:         a.summarizer.overallWithPercentiles(a.opts.percentiles),
+		GroupBy:         a.summarizer.GroupBy(),
+		Windows:         windows,
+	}
+}
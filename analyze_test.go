@@ -0,0 +1,199 @@
+package querydigest
+
+import (
+	"context"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnalyze(t *testing.T) {
+	cases := []struct {
+		name          string
+		opts          []Option
+		expectSamples []string
+		expectCount   int
+		expectUnique  int
+	}{
+		{
+			name:          "sequential",
+			opts:          []Option{WithConcurrency(1)},
+			expectSamples: []string{"CREATE TABLE `shippings` (", "DROP TABLE IF EXISTS `shippings`;", "show databases;", "select @@version_comment limit 1;", "SELECT DATABASE();"},
+			expectCount:   5,
+			expectUnique:  5,
+		},
+		{
+			name:          "parallel",
+			opts:          []Option{WithConcurrency(4)},
+			expectSamples: []string{"CREATE TABLE `shippings` (", "DROP TABLE IF EXISTS `shippings`;", "show databases;", "select @@version_comment limit 1;", "SELECT DATABASE();"},
+			expectCount:   5,
+			expectUnique:  5,
+		},
+		{
+			name:          "limit",
+			opts:          []Option{WithLimit(1), WithSortOrder(SortOrder{Key: SortByTotalTime, Ascending: true})},
+			expectSamples: []string{"SELECT DATABASE();"},
+			expectCount:   5,
+			expectUnique:  5,
+		},
+		{
+			name: "filter",
+			opts: []Option{WithFilter(FilterFunc(func(i *SlowQueryInfo) bool {
+				return i.QueryTime.QueryTime < 0.0001
+			}))},
+			expectSamples: []string{"SELECT DATABASE();"},
+			expectCount:   1,
+			expectUnique:  1,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			f, err := os.Open("./testdata/mysql-slow.createtable.log")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			report, err := Analyze(context.Background(), f, c.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(report.Summaries) != len(c.expectSamples) {
+				t.Fatalf("expect %d summaries but %d", len(c.expectSamples), len(report.Summaries))
+			}
+			for i, s := range report.Summaries {
+				if !strings.HasPrefix(s.RowSample, c.expectSamples[i]) {
+					t.Errorf("summary %d: expect `%s` but `%s`", i, c.expectSamples[i], s.RowSample)
+				}
+			}
+			if report.TotalQueryCount != c.expectCount {
+				t.Errorf("expect total count %d but %d", c.expectCount, report.TotalQueryCount)
+			}
+			if report.UniqueQueries != c.expectUnique {
+				t.Errorf("expect %d unique queries but %d", c.expectUnique, report.UniqueQueries)
+			}
+		})
+	}
+}
+
+func TestAnalyze_timeRange(t *testing.T) {
+	f, err := os.Open("./testdata/mysql-slow.createtable.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	report, err := Analyze(context.Background(), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if math.Abs(report.TotalQueryTime-0.076161) > 1e-9 {
+		t.Errorf("unexpected total query time %f", report.TotalQueryTime)
+	}
+	if since := time.Date(2020, 1, 17, 5, 59, 9, 832280000, time.UTC); !report.Since.Equal(since) {
+		t.Errorf("expect since %v but %v", since, report.Since)
+	}
+	if until := time.Date(2020, 1, 17, 6, 6, 15, 162769000, time.UTC); !report.Until.Equal(until) {
+		t.Errorf("expect until %v but %v", until, report.Until)
+	}
+}
+
+func TestAnalyze_canceled(t *testing.T) {
+	f, err := os.Open("./testdata/mysql-slow.createtable.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := Analyze(ctx, f, WithConcurrency(1)); err != context.Canceled {
+		t.Errorf("expect context.Canceled but %v", err)
+	}
+}
+
+func TestAnalyzeSources(t *testing.T) {
+	var sources []Source
+	for _, name := range []string{"./testdata/mysql-slow.group.log", "./testdata/mysql-slow.group.log.bz2", "./testdata/mysql-slow.malformed.log"} {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		sources = append(sources, Source{Name: name, Reader: f})
+	}
+
+	for _, concurrency := range []int{1, 4} {
+		for _, s := range sources {
+			if _, err := s.Reader.(*os.File).Seek(0, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		report, err := AnalyzeSources(context.Background(), sources, WithConcurrency(concurrency), WithGroupBy(GroupBy{DimensionFile}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		counts := make(map[string]int)
+		for _, s := range report.Summaries {
+			counts[s.Group[0]] = s.TotalQueryCount
+		}
+		if counts["./testdata/mysql-slow.group.log"] != 3 || counts["./testdata/mysql-slow.group.log.bz2"] != 3 {
+			t.Errorf("concurrency %d: unexpected counts per file: %v", concurrency, counts)
+		}
+		if len(report.ParseErrors) == 0 {
+			t.Fatalf("concurrency %d: expect parse errors of the malformed log", concurrency)
+		}
+		for _, e := range report.ParseErrors {
+			if e.Source != "./testdata/mysql-slow.malformed.log" {
+				t.Errorf("concurrency %d: unexpected source of parse error: %v", concurrency, e)
+			}
+		}
+	}
+}
+
+func TestAnalyze_reportInterval(t *testing.T) {
+	src, err := os.ReadFile("./testdata/mysql-slow.group.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pr, pw := io.Pipe()
+	reports := make(chan *Report, 100)
+	done := make(chan error, 1)
+	go func() {
+		_, err := Analyze(context.Background(), pr, WithReportInterval(time.Millisecond, func(r *Report) {
+			select {
+			case reports <- r:
+			default:
+			}
+		}))
+		done <- err
+	}()
+
+	if _, err := pw.Write(src); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.After(5 * time.Second)
+	for got := false; !got; {
+		select {
+		case r := <-reports:
+			got = r.TotalQueryCount == 3 && len(r.Summaries) == 3
+		case <-deadline:
+			t.Fatal("no interim report of the written events")
+		}
+	}
+
+	pw.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
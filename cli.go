@@ -1,104 +1,89 @@
 package querydigest
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
-	"sync"
+	"strings"
+	"time"
 )
 
-func Run(w io.Writer, src io.Reader, previewSize, concurrency int) {
+func Run(w io.Writer, src io.Reader, previewSize, concurrency int) error {
 
-	results, total, err := analyzeSlowQuery(src, concurrency)
+	report, err := Analyze(context.Background(), src, WithConcurrency(concurrency), WithLimit(previewSize))
 	if err != nil {
-		log.Fatal("analyzeSlowQuery:", err)
+		return fmt.Errorf("analyzeSlowQuery: %w", err)
 	}
-
-	if previewSize != 0 && previewSize <= len(results) {
-		results = results[0:previewSize]
+	for _, e := range report.ParseErrors {
+		log.Print("skipped malformed entry: ", e)
 	}
 
-	print(w, results, total)
+	print(w, report, defaultWidth)
+	return nil
 }
 
-func print(w io.Writer, summaries []*SlowQuerySummary, totalTime float64) {
-	for i, s := range summaries {
+func print(w io.Writer, report *Report, width int) {
+	totalTime := report.TotalQueryTime
+	if width <= 0 {
+		width = defaultWidth
+	}
+	for i, s := range report.Summaries {
 		fmt.Fprintln(w)
-		fmt.Fprintf(w, "Query %d\n", i)
+		fmt.Fprintf(w, "Query %d (ID %s)\n", i, s.QueryID())
+		if len(s.Group) > 0 {
+			if label := report.GroupBy.label(s.Group); label != "" {
+				fmt.Fprintf(w, "%s\n", label)
+			}
+		}
 		fmt.Fprintf(w, "%f%%\n\n", (s.TotalTime/totalTime)*100)
-		fmt.Fprintf(w, "%s", s.String())
+		if ts := s.TimeSeries(); ts != nil {
+			printTimeSeries(w, ts)
+		}
+		fmt.Fprintf(w, "%s", s.format(width))
 		fmt.Fprintln(w)
 	}
-}
-
-func analyzeSlowQuery(r io.Reader, concurrency int) ([]*SlowQuerySummary, float64, error) {
-	if concurrency > 1 {
-		return analyzeSlowQueryParallel(r, concurrency)
-	}
-	summarizer := NewSummarizer()
-	slowQueryScanner := NewSlowQueryScanner(r)
-	for slowQueryScanner.Next() {
-		s := slowQueryScanner.SlowQueryInfo()
-		res, err := ReplaceWithZeroValue(s.RawQuery)
-		if err != nil {
-			b := s.RawQuery
-			if len(b) > 60 {
-				b = b[:60]
-			}
-			log.Print("replace failed: ", string(b))
-			continue
-		}
-		s.ParsedQuery = res
-		summarizer.Collect(s)
+	if len(report.Windows) > 0 {
+		printWindows(w, report)
 	}
-	if err := slowQueryScanner.Err(); err != nil {
-		return nil, 0, err
+	if len(report.Unparsed) > 0 {
+		fmt.Fprintln(w)
+		printUnparsed(w, report)
 	}
-	qs := summarizer.Summarize()
-	return qs, summarizer.TotalQueryTime(), nil
 }
 
-func analyzeSlowQueryParallel(r io.Reader, concurrency int) ([]*SlowQuerySummary, float64, error) {
-	parsequeue := make(chan *SlowQueryInfo, 500)
-	go parseRawFile(r, parsequeue)
-	summarizer := NewSummarizer()
-	var wg sync.WaitGroup
-
-	for i := 0; i < concurrency; i++ {
-
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for s := range parsequeue {
-				res, err := ReplaceWithZeroValue(s.RawQuery)
-				if err != nil {
-					b := s.RawQuery
-					if len(b) > 60 {
-						b = b[:60]
-					}
-					log.Print("replace failed: ", string(b))
-					continue
-				}
-				s.ParsedQuery = res
-				summarizer.Collect(s)
-			}
-		}()
+func printTimeSeries(w io.Writer, ts *TimeSeries) {
+	counts := make([]float64, len(ts.Count))
+	totals := make([]float64, len(ts.Total))
+	p95s := make([]float64, len(ts.P95))
+	for i := range ts.Count {
+		counts[i], totals[i], p95s[i] = float64(ts.Count[i]), float64(ts.Total[i]), float64(ts.P95[i])
 	}
-	wg.Wait()
-
-	qs := summarizer.Summarize()
-
-	return qs, summarizer.TotalQueryTime(), nil
+	fmt.Fprintf(w, "Time series (%s buckets from %s):\n", ts.Bucket, ts.Start.Format(time.RFC3339))
+	fmt.Fprintf(w, "calls\t%s\n", sparkline(counts))
+	fmt.Fprintf(w, "total\t%s\n", sparkline(totals))
+	fmt.Fprintf(w, "95%%\t%s\n\n", sparkline(p95s))
 }
 
-func parseRawFile(r io.Reader, parsequeue chan *SlowQueryInfo) {
-	slowqueryscanner := NewSlowQueryScanner(r)
-
-	for slowqueryscanner.Next() {
-		parsequeue <- slowqueryscanner.SlowQueryInfo().clone()
-	}
-	if err := slowqueryscanner.Err(); err != nil {
-		log.Fatal("slowQueryScanner:", err)
+func printWindows(w io.Writer, report *Report) {
+	fmt.Fprintln(w, "Windows:")
+	for _, win := range report.Windows {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "%s - %s\t%d queries\t%0.2fs\n",
+			win.Start.Format(time.RFC3339), win.End.Format(time.RFC3339), win.TotalQueryCount, win.TotalQueryTime)
+		for _, s := range win.Summaries {
+			item := s.Fingerprint
+			if len(s.Group) > 0 {
+				item = strings.TrimSpace(report.GroupBy.label(s.Group) + " " + item)
+			}
+			if len(item) > 60 {
+				item = item[:57] + "..."
+			}
+			var p95 Seconds
+			if st := s.Stats(); st != nil {
+				p95 = st.ExecTime.P95
+			}
+			fmt.Fprintf(w, "  %s\tcount %d\ttotal %0.2fs\t95%% %v\t%s\n", s.QueryID(), s.TotalQueryCount, s.TotalTime, p95, item)
+		}
 	}
-	close(parsequeue)
 }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+
+	"github.com/akito0107/querydigest"
+)
+
+// runDiff implements `querydigest diff [flags] baseline candidate`.
+func runDiff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: querydigest diff [flags] baseline candidate\n")
+		fs.PrintDefaults()
+	}
+	previewSize := fs.Int("n", 0, "count")
+	concurrency := fs.Int("j", 0, "concurrency (default = num of cpus)")
+	output := fs.String("output", "text", "output format (text, json)")
+	groupBy := fs.String("group-by", "fingerprint", "comma separated dimensions to match the queries by (fingerprint, user, host, db, table, type, file)")
+	fingerprint := fs.String("fingerprint", "ast", "how queries are normalized: ast (parse, falling back to lexical) or lexical (faster)")
+	normalize := fs.String("normalize", "", "comma separated options of the ast fingerprints: placeholders, upper, lower, unquote, strip-db, collapse-limit")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	format, err := querydigest.ParseFormat(*output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	group, err := querydigest.ParseGroupBy(*groupBy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mode, err := querydigest.ParseFingerprintMode(*fingerprint)
+	if err != nil {
+		log.Fatal(err)
+	}
+	normalizer, err := querydigest.ParseNormalizer(*normalize)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *concurrency == 0 {
+		*concurrency = runtime.NumCPU()
+	}
+
+	var reports []*querydigest.Report
+	for _, path := range fs.Args() {
+		sources, closeSources, err := openSources([]string{path})
+		if err != nil {
+			log.Fatal(err)
+		}
+		report, err := analyzeSources(context.Background(), sources,
+			querydigest.WithConcurrency(*concurrency), querydigest.WithGroupBy(group), querydigest.WithFingerprint(mode), querydigest.WithNormalizer(normalizer))
+		closeSources()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, e := range report.ParseErrors {
+			log.Print("skipped malformed entry: ", e)
+		}
+		reports = append(reports, report)
+	}
+
+	diff := querydigest.Diff(reports[0], reports[1])
+	if *previewSize > 0 && *previewSize < len(diff.Queries) {
+		diff.Queries = diff.Queries[:*previewSize]
+	}
+	if err := diff.Write(stdout, format); err != nil {
+		log.Fatal(err)
+	}
+}
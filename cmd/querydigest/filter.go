@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/akito0107/querydigest"
+)
+
+var since = flag.String("since", "", "only digest events at or after this time (RFC3339 or \"2006-01-02 15:04:05\")")
+var until = flag.String("until", "", "only digest events before this time (RFC3339 or \"2006-01-02 15:04:05\")")
+var minTime = flag.Duration("min-time", 0, "only digest events whose query time is at least this long, e.g. 100ms")
+var users = flag.String("user", "", "only digest events of these comma separated users")
+var hosts = flag.String("host", "", "only digest events from these comma separated hosts")
+var databases = flag.String("db", "", "only digest events on these comma separated databases")
+var statementTypes = flag.String("type", "", "only digest these comma separated statement types, e.g. SELECT,UPDATE")
+var match = flag.String("match", "", "only digest queries matching this regular expression")
+
+func filters() ([]querydigest.Filter, error) {
+	var fs []querydigest.Filter
+
+	if *since != "" || *until != "" {
+		s, err := parseTime(*since)
+		if err != nil {
+			return nil, fmt.Errorf("-since: %w", err)
+		}
+		u, err := parseTime(*until)
+		if err != nil {
+			return nil, fmt.Errorf("-until: %w", err)
+		}
+		fs = append(fs, querydigest.TimeRangeFilter(s, u))
+	}
+	if *minTime > 0 {
+		fs = append(fs, querydigest.MinQueryTimeFilter(*minTime))
+	}
+	if *users != "" {
+		fs = append(fs, querydigest.UserFilter(splitList(*users)...))
+	}
+	if *hosts != "" {
+		fs = append(fs, querydigest.HostFilter(splitList(*hosts)...))
+	}
+	if *databases != "" {
+		fs = append(fs, querydigest.DatabaseFilter(splitList(*databases)...))
+	}
+	if *statementTypes != "" {
+		fs = append(fs, querydigest.StatementTypeFilter(splitList(*statementTypes)...))
+	}
+	if *match != "" {
+		re, err := regexp.Compile(*match)
+		if err != nil {
+			return nil, fmt.Errorf("-match: %w", err)
+		}
+		fs = append(fs, querydigest.QueryRegexpFilter(re))
+	}
+
+	return fs, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %s", s)
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"time"
+
+	"github.com/akito0107/querydigest"
+)
+
+var follow = flag.Bool("follow", false, "keep reading the slow log as it grows, like tail -F, and refresh the report until interrupted")
+var refresh = flag.Duration("refresh", 5*time.Second, "interval to refresh the report in follow mode")
+
+const followPoll = 200 * time.Millisecond
+
+func followSources(ctx context.Context, paths []string) ([]querydigest.Source, func(), error) {
+	if len(paths) != 1 || paths[0] == "-" {
+		return nil, nil, errors.New("-follow takes a single slow log file")
+	}
+	r, err := querydigest.Follow(ctx, paths[0], followPoll)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []querydigest.Source{{Name: paths[0], Reader: r}}, func() { r.Close() }, nil
+}
+
+// render redraws the interim report, clearing the terminal unless the output is meant for machines.
+func render(w io.Writer, format querydigest.Format) func(*querydigest.Report) {
+	return func(report *querydigest.Report) {
+		if format != querydigest.FormatJSON {
+			io.WriteString(w, "\x1b[H\x1b[2J")
+		}
+		if err := report.WriteWidth(w, format, terminalWidth()); err != nil {
+			log.Print(err)
+		}
+	}
+}
@@ -1,34 +1,145 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
 
 	"github.com/akito0107/querydigest"
 )
 
-var slowLogPath = flag.String("f", "slow.log", "slow log filepath")
+var slowLogPath = flag.String("f", "slow.log", "slow log filepath, optionally compressed with gzip, zstd, bzip2 or xz; ignored when files are given as arguments")
 var previewSize = flag.Int("n", 0, "count")
 var concurrency = flag.Int("j", 0, "concurrency (default = num of cpus)")
+var output = flag.String("output", "text", "output format (text, json, pt)")
+var groupBy = flag.String("group-by", "fingerprint", "comma separated dimensions to aggregate by (fingerprint, user, host, db, table, type, file)")
+var timeSeries = flag.Duration("time-series", 0, "add the calls, total time and p95 per bucket of this size to each query, e.g. 1m (text and json output)")
+var window = flag.Duration("window", 0, "also digest the events per time window of this size, e.g. 5m (text and json output)")
+var percentiles = flag.String("percentiles", "95,50", "comma separated percentiles of the stats, e.g. 50,90,95,99,99.9 (text and json output)")
+var fingerprint = flag.String("fingerprint", "ast", "how queries are normalized: ast (parse, falling back to lexical) or lexical (faster)")
+var normalize = flag.String("normalize", "", "comma separated options of the ast fingerprints: placeholders, upper, lower, unquote, strip-db, collapse-limit")
+var histogram = flag.String("histogram", "decade", "Query_time histogram buckets: decade, 1-2-5 (log-linear) or comma separated lower bounds, e.g. 10ms,20ms,50ms,100ms")
+var sortOrder = flag.String("sort", "total", "sort key[:asc|desc] (total, avg, max, p95, lock, count, rows_examined, rows_sent, ratio)")
 
 func main() {
 	// defer profile.Start(profile.ProfilePath("."), profile.TraceProfile).Stop()
 	// defer profile.Start(profile.ProfilePath("."), profile.CPUProfile).Stop()
 	// defer profile.Start(profile.ProfilePath("."), profile.MemProfile).Stop()
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "diff":
+			runDiff(os.Args[2:])
+			return
+		case "merge":
+			runMerge(os.Args[2:])
+			return
+		}
+	}
+
 	flag.Parse()
 
-	f, err := os.Open(*slowLogPath)
+	format, err := querydigest.ParseFormat(*output)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	order, err := querydigest.ParseSortOrder(*sortOrder)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	group, err := querydigest.ParseGroupBy(*groupBy)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ps, err := querydigest.ParsePercentiles(*percentiles)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mode, err := querydigest.ParseFingerprintMode(*fingerprint)
+	if err != nil {
+		log.Fatal(err)
+	}
+	normalizer, err := querydigest.ParseNormalizer(*normalize)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer f.Close()
+
+	bounds, err := querydigest.ParseHistogramBounds(*histogram)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fs, err := filters()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	paths := flag.Args()
+	if len(paths) == 0 {
+		paths = []string{*slowLogPath}
+	}
+	open := openSources
+	if *follow {
+		// interrupting stops following; the events read so far are still reported
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		open = func(paths []string) ([]querydigest.Source, func(), error) {
+			return followSources(ctx, paths)
+		}
+	}
+	sources, closeSources, err := open(paths)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer closeSources()
 
 	if *concurrency == 0 {
 		*concurrency = runtime.NumCPU()
 	}
 
-	querydigest.Run(os.Stdout, f, *previewSize, *concurrency)
+	opts := []querydigest.Option{
+		querydigest.WithConcurrency(*concurrency),
+		querydigest.WithLimit(*previewSize),
+		querydigest.WithSortOrder(order),
+		querydigest.WithGroupBy(group),
+		querydigest.WithWindow(*window),
+		querydigest.WithTimeSeries(*timeSeries),
+		querydigest.WithPercentiles(ps),
+		querydigest.WithHistogramBounds(bounds),
+		querydigest.WithFingerprint(mode),
+		querydigest.WithNormalizer(normalizer),
+	}
+	for _, f := range fs {
+		opts = append(opts, querydigest.WithFilter(f))
+	}
+	summarizer := querydigest.NewGroupedSummarizer(group)
+	opts = append(opts, querydigest.WithSummarizer(summarizer))
+	if *follow {
+		opts = append(opts, querydigest.WithReportInterval(*refresh, render(stdout, format)))
+	}
+
+	report, err := analyzeSources(context.Background(), sources, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, e := range report.ParseErrors {
+		log.Print("skipped malformed entry: ", e)
+	}
+	if *save != "" {
+		if err := writeSnapshot(*save, summarizer); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if err := report.WriteWidth(stdout, format, terminalWidth()); err != nil {
+		log.Fatal(err)
+	}
 }
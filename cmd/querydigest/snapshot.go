@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/akito0107/querydigest"
+)
+
+var save = flag.String("save", "", "also save the digest as a snapshot to this file, to be combined by the merge command")
+
+func writeSnapshot(path string, s *querydigest.Summarizer) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := s.WriteSnapshot(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func readSnapshot(path string) (*querydigest.Summarizer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s, err := querydigest.ReadSnapshot(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// runMerge implements `querydigest merge [flags] snapshot...`.
+func runMerge(args []string) {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: querydigest merge [flags] snapshot...\n")
+		fs.PrintDefaults()
+	}
+	previewSize := fs.Int("n", 0, "count")
+	output := fs.String("output", "text", "output format (text, json, pt)")
+	sortOrder := fs.String("sort", "total", "sort key[:asc|desc] (total, avg, max, p95, lock, count, rows_examined, rows_sent, ratio)")
+	percentiles := fs.String("percentiles", "95,50", "comma separated percentiles of the stats, e.g. 50,90,95,99,99.9 (text and json output)")
+	saveMerged := fs.String("save", "", "also save the merged digest as a snapshot to this file")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	format, err := querydigest.ParseFormat(*output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	order, err := querydigest.ParseSortOrder(*sortOrder)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ps, err := querydigest.ParsePercentiles(*percentiles)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var merged *querydigest.Summarizer
+	for _, pattern := range fs.Args() {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(paths) == 0 {
+			paths = []string{pattern}
+		}
+		for _, path := range paths {
+			s, err := readSnapshot(path)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if merged == nil {
+				merged = s
+				continue
+			}
+			if err := merged.Merge(s); err != nil {
+				log.Fatalf("%s: %v", path, err)
+			}
+		}
+	}
+
+	if *saveMerged != "" {
+		if err := writeSnapshot(*saveMerged, merged); err != nil {
+			log.Fatal(err)
+		}
+	}
+	report := merged.Report(querydigest.WithSortOrder(order), querydigest.WithLimit(*previewSize), querydigest.WithPercentiles(ps))
+	if err := report.WriteWidth(stdout, format, terminalWidth()); err != nil {
+		log.Fatal(err)
+	}
+}
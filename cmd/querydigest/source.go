@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/akito0107/querydigest"
+)
+
+// openSources opens the given paths in order. Shell-style globs are expanded
+// and "-" reads the standard input.
+func openSources(paths []string) ([]querydigest.Source, func(), error) {
+	var files []*os.File
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+
+	var sources []querydigest.Source
+	for _, p := range paths {
+		if p == "-" {
+			sources = append(sources, querydigest.Source{Name: "stdin", Reader: os.Stdin})
+			continue
+		}
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("%s: %w", p, err)
+		}
+		if len(matches) == 0 {
+			// not a pattern, let os.Open report the missing file
+			matches = []string{p}
+		}
+		for _, m := range matches {
+			f, err := os.Open(m)
+			if err != nil {
+				closeAll()
+				return nil, nil, err
+			}
+			files = append(files, f)
+			sources = append(sources, querydigest.Source{Name: m, Reader: f})
+		}
+	}
+	return sources, closeAll, nil
+}
+
+// stdout is the standard output the reports are written to. analyzeSources
+// points os.Stdout to stderr while the queries are parsed, since xsqlparser
+// prints the tokens of the statements it fails to parse to os.Stdout, which
+// would corrupt e.g. the JSON report.
+var stdout = os.Stdout
+
+func analyzeSources(ctx context.Context, sources []querydigest.Source, opts ...querydigest.Option) (*querydigest.Report, error) {
+	orig := os.Stdout
+	os.Stdout = os.Stderr
+	defer func() { os.Stdout = orig }()
+	return querydigest.AnalyzeSources(ctx, sources, opts...)
+}
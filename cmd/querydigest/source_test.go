@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/akito0107/querydigest"
+)
+
+func TestAnalyzeSources_jsonOutput(t *testing.T) {
+	out, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	orig := os.Stdout
+	os.Stdout = out
+	defer func() { os.Stdout = orig }()
+
+	sources, closeSources, err := openSources([]string{"../../testdata/mysql-slow.unparsable.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeSources()
+	report, err := analyzeSources(context.Background(), sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := report.Write(out, querydigest.FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := out.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	dec := json.NewDecoder(out)
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil {
+		t.Fatalf("output is not a JSON document: %v", err)
+	}
+	if dec.More() {
+		t.Error("output has data after the JSON document")
+	}
+	if len(report.Unparsed) == 0 {
+		t.Error("expect unparsed queries in the fixture")
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"os"
+	"strconv"
+
+	"golang.org/x/term"
+)
+
+// terminalWidth returns the width of the terminal on stdout, or of $COLUMNS
+// when stdout is not a terminal, e.g. piped to less; 0 if both are unknown.
+func terminalWidth() int {
+	if w, _, err := term.GetSize(int(stdout.Fd())); err == nil && w > 0 {
+		return w
+	}
+	w, _ := strconv.Atoi(os.Getenv("COLUMNS"))
+	return w
+}
@@ -0,0 +1,98 @@
+package querydigest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+func TestDecompress(t *testing.T) {
+	plain, err := os.ReadFile("./testdata/mysql-slow.group.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bz2, err := os.ReadFile("./testdata/mysql-slow.group.log.bz2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compress := func(t *testing.T, newWriter func(io.Writer) (io.WriteCloser, error), chunks ...[]byte) []byte {
+		var b bytes.Buffer
+		for _, c := range chunks {
+			w, err := newWriter(&b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write(c); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return b.Bytes()
+	}
+	newGzip := func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil }
+	newZstd := func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) }
+	newXz := func(w io.Writer) (io.WriteCloser, error) { return xz.NewWriter(w) }
+
+	half := bytes.Index(plain[len(plain)/2:], []byte("\n# Time:")) + len(plain)/2 + 1
+
+	cases := []struct {
+		name string
+		src  []byte
+	}{
+		{name: "plain", src: plain},
+		{name: "gzip", src: compress(t, newGzip, plain)},
+		{name: "gzip multistream", src: compress(t, newGzip, plain[:half], plain[half:])},
+		{name: "zstd", src: compress(t, newZstd, plain)},
+		{name: "bzip2", src: bz2},
+		{name: "xz", src: compress(t, newXz, plain)},
+		{name: "empty", src: nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, err := Decompress(bytes.NewReader(c.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.src == nil {
+				if len(got) != 0 {
+					t.Errorf("expect empty but %q", got)
+				}
+				return
+			}
+			if !bytes.Equal(got, plain) {
+				t.Errorf("decompressed contents differ:\n%s", got)
+			}
+		})
+	}
+}
+
+func TestAnalyze_compressed(t *testing.T) {
+	f, err := os.Open("./testdata/mysql-slow.group.log.bz2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	report, err := Analyze(context.Background(), f, WithConcurrency(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.TotalQueryCount != 3 {
+		t.Errorf("expect 3 queries but %d", report.TotalQueryCount)
+	}
+}
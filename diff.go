@@ -0,0 +1,242 @@
+package querydigest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/table"
+)
+
+type DiffStatus string
+
+const (
+	// DiffNew is a query which only appears in the candidate.
+	DiffNew DiffStatus = "new"
+	// DiffGone is a query which only appears in the baseline.
+	DiffGone    DiffStatus = "gone"
+	DiffChanged DiffStatus = "changed"
+)
+
+// QueryDiff pairs the summaries of a query in the baseline and the candidate.
+type QueryDiff struct {
+	Checksum    uint64
+	Fingerprint string
+	Group       []string
+	// Baseline is nil for a new query, Candidate for a disappeared one.
+	Baseline  *SlowQuerySummary
+	Candidate *SlowQuerySummary
+}
+
+func (d *QueryDiff) QueryID() string {
+	return fmt.Sprintf("0x%016X", d.Checksum)
+}
+
+func (d *QueryDiff) Status() DiffStatus {
+	switch {
+	case d.Baseline == nil:
+		return DiffNew
+	case d.Candidate == nil:
+		return DiffGone
+	default:
+		return DiffChanged
+	}
+}
+
+// Impact is the change of the total query time, negative for an improvement.
+func (d *QueryDiff) Impact() float64 {
+	return diffValuesOf(d.Candidate).Total - diffValuesOf(d.Baseline).Total
+}
+
+// DiffReport compares two reports, e.g. of the logs before and after a deploy.
+type DiffReport struct {
+	Baseline  *Report
+	Candidate *Report
+	// Queries are sorted by the absolute Impact, largest first.
+	Queries []*QueryDiff
+}
+
+// Diff matches the summaries of the reports by their checksum, i.e. by the
+// normalized query or group. The reports should be analyzed without a limit,
+// otherwise queries beyond the limit are reported as new or gone.
+func Diff(baseline, candidate *Report) *DiffReport {
+	byChecksum := make(map[uint64]*QueryDiff)
+	var queries []*QueryDiff
+	add := func(s *SlowQuerySummary) *QueryDiff {
+		d, ok := byChecksum[s.Checksum]
+		if !ok {
+			d = &QueryDiff{Checksum: s.Checksum, Fingerprint: s.Fingerprint, Group: s.Group}
+			byChecksum[s.Checksum] = d
+			queries = append(queries, d)
+		}
+		return d
+	}
+	for _, s := range baseline.Summaries {
+		add(s).Baseline = s
+	}
+	for _, s := range candidate.Summaries {
+		add(s).Candidate = s
+	}
+
+	sort.SliceStable(queries, func(i, j int) bool {
+		a, b := math.Abs(queries[i].Impact()), math.Abs(queries[j].Impact())
+		if a == b {
+			return queries[i].Checksum < queries[j].Checksum
+		}
+		return a > b
+	})
+
+	return &DiffReport{Baseline: baseline, Candidate: candidate, Queries: queries}
+}
+
+// diffValues are the compared values of a summary, zero for a missing one.
+type diffValues struct {
+	Count        int     `json:"count"`
+	Total        float64 `json:"total"`
+	Avg          float64 `json:"avg"`
+	P95          float64 `json:"p95"`
+	RowsExamined int     `json:"rows_examined"`
+}
+
+func diffValuesOf(s *SlowQuerySummary) diffValues {
+	if s == nil {
+		return diffValues{}
+	}
+	v := diffValues{
+		Count:        s.TotalQueryCount,
+		Total:        s.TotalTime,
+		RowsExamined: s.TotalRowsExamined,
+	}
+	if s.TotalQueryCount > 0 {
+		v.Avg = s.TotalTime / float64(s.TotalQueryCount)
+	}
+	if st := s.Stats(); st != nil {
+		v.P95 = float64(st.ExecTime.P95)
+	}
+	return v
+}
+
+// Write renders the diff to w in the given format. FormatPtQueryDigest is not supported.
+func (r *DiffReport) Write(w io.Writer, format Format) error {
+	switch format {
+	case FormatText, "":
+		r.writeText(w)
+		return nil
+	case FormatJSON:
+		return r.writeJSON(w)
+	}
+	return fmt.Errorf("unsupported output format of diff: %s", format)
+}
+
+func (r *DiffReport) writeText(w io.Writer) {
+	fmt.Fprintf(w, "Baseline:\t%d queries\t%0.2fs\n", r.Baseline.TotalQueryCount, r.Baseline.TotalQueryTime)
+	fmt.Fprintf(w, "Candidate:\t%d queries\t%0.2fs\n\n", r.Candidate.TotalQueryCount, r.Candidate.TotalQueryTime)
+
+	t := table.NewWriter()
+	t.SetOutputMirror(w)
+	t.AppendHeader(table.Row{"Status", "Query ID", "Impact", "Count", "Total", "Avg", "95%", "Rows Examine", "Query"})
+	for _, d := range r.Queries {
+		b, c := diffValuesOf(d.Baseline), diffValuesOf(d.Candidate)
+		item := d.Fingerprint
+		if len(d.Group) > 0 {
+			item = strings.TrimSpace(r.Candidate.GroupBy.label(d.Group) + " " + item)
+		}
+		if len(item) > 50 {
+			item = item[:47] + "..."
+		}
+		t.AppendRow(table.Row{
+			d.Status(), d.QueryID(), fmt.Sprintf("%+0.2fs", d.Impact()),
+			diffCell(d, float64(b.Count), float64(c.Count), func(f float64) string { return fmt.Sprintf("%.0f", f) }),
+			diffCell(d, b.Total, c.Total, secondsString),
+			diffCell(d, b.Avg, c.Avg, secondsString),
+			diffCell(d, b.P95, c.P95, secondsString),
+			diffCell(d, float64(b.RowsExamined), float64(c.RowsExamined), func(f float64) string { return fmt.Sprintf("%.0f", f) }),
+			item,
+		})
+	}
+	t.Render()
+}
+
+func secondsString(f float64) string {
+	return Seconds(f).String()
+}
+
+// diffCell formats a value as `before -> after (+x%)`.
+func diffCell(d *QueryDiff, before, after float64, format func(float64) string) string {
+	switch d.Status() {
+	case DiffNew:
+		return "- -> " + format(after)
+	case DiffGone:
+		return format(before) + " -> -"
+	}
+	cell := format(before) + " -> " + format(after)
+	if before > 0 {
+		cell += fmt.Sprintf(" (%+.0f%%)", (after-before)/before*100)
+	}
+	return cell
+}
+
+type jsonDiffReport struct {
+	Version   int              `json:"version"`
+	Baseline  jsonDiffTotals   `json:"baseline"`
+	Candidate jsonDiffTotals   `json:"candidate"`
+	Queries   []*jsonQueryDiff `json:"queries"`
+}
+
+type jsonDiffTotals struct {
+	TotalQueryTime  Seconds `json:"total_query_time"`
+	TotalQueryCount int     `json:"total_query_count"`
+	UniqueQueries   int     `json:"unique_queries"`
+}
+
+type jsonQueryDiff struct {
+	Status      DiffStatus        `json:"status"`
+	QueryID     string            `json:"query_id"`
+	Fingerprint string            `json:"fingerprint,omitempty"`
+	Group       map[string]string `json:"group,omitempty"`
+	Impact      Seconds           `json:"impact"`
+	Baseline    *diffValues       `json:"baseline"`
+	Candidate   *diffValues       `json:"candidate"`
+}
+
+func (r *DiffReport) writeJSON(w io.Writer) error {
+	totals := func(r *Report) jsonDiffTotals {
+		return jsonDiffTotals{
+			TotalQueryTime:  Seconds(r.TotalQueryTime),
+			TotalQueryCount: r.TotalQueryCount,
+			UniqueQueries:   r.UniqueQueries,
+		}
+	}
+	values := func(s *SlowQuerySummary) *diffValues {
+		if s == nil {
+			return nil
+		}
+		v := diffValuesOf(s)
+		return &v
+	}
+
+	out := &jsonDiffReport{
+		Version:   jsonSchemaVersion,
+		Baseline:  totals(r.Baseline),
+		Candidate: totals(r.Candidate),
+		Queries:   make([]*jsonQueryDiff, 0, len(r.Queries)),
+	}
+	for _, d := range r.Queries {
+		out.Queries = append(out.Queries, &jsonQueryDiff{
+			Status:      d.Status(),
+			QueryID:     d.QueryID(),
+			Fingerprint: d.Fingerprint,
+			Group:       jsonGroup(r.Candidate.GroupBy, d.Group),
+			Impact:      Seconds(d.Impact()),
+			Baseline:    values(d.Baseline),
+			Candidate:   values(d.Candidate),
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
@@ -0,0 +1,94 @@
+package querydigest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func analyzeFile(t *testing.T, name string, opts ...Option) *Report {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	report, err := Analyze(context.Background(), f, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestDiff(t *testing.T) {
+	baseline := analyzeFile(t, "./testdata/mysql-slow.group.log")
+	candidate := analyzeFile(t, "./testdata/mysql-slow.timeseries.log")
+
+	diff := Diff(baseline, candidate)
+
+	type query struct {
+		Status      DiffStatus
+		Fingerprint string
+		Impact      float64
+	}
+	var got []query
+	for _, d := range diff.Queries {
+		got = append(got, query{Status: d.Status(), Fingerprint: d.Fingerprint, Impact: math.Round(d.Impact()*1000) / 1000})
+	}
+	expect := []query{
+		{Status: DiffChanged, Fingerprint: "SELECT * FROM users WHERE id = 0", Impact: 3},
+		{Status: DiffGone, Fingerprint: "UPDATE items SET price = 0 WHERE id = 0", Impact: -0.3},
+		{Status: DiffGone, Fingerprint: "SELECT * FROM items JOIN users ON items.user_id = users.id WHERE items.id = 0", Impact: -0.1},
+	}
+	if diff := cmp.Diff(got, expect); diff != "" {
+		t.Errorf("diff: %s", diff)
+	}
+
+	reversed := Diff(candidate, baseline)
+	if s := reversed.Queries[1].Status(); s != DiffNew {
+		t.Errorf("expect new but %s", s)
+	}
+}
+
+func TestDiffReport_Write(t *testing.T) {
+	diff := Diff(analyzeFile(t, "./testdata/mysql-slow.group.log"), analyzeFile(t, "./testdata/mysql-slow.timeseries.log"))
+
+	var b bytes.Buffer
+	if err := diff.Write(&b, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Version int `json:"version"`
+		Queries []struct {
+			Status    string           `json:"status"`
+			Baseline  *json.RawMessage `json:"baseline"`
+			Candidate *json.RawMessage `json:"candidate"`
+		} `json:"queries"`
+	}
+	if err := json.Unmarshal(b.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Version != jsonSchemaVersion || len(out.Queries) != 3 {
+		t.Fatalf("unexpected output: %s", b.String())
+	}
+	if out.Queries[1].Status != "gone" || out.Queries[1].Candidate != nil {
+		t.Errorf("a disappeared query must have no candidate: %s", b.String())
+	}
+
+	b.Reset()
+	if err := diff.Write(&b, FormatText); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b.Bytes(), []byte("1 -> 4 (+300%)")) {
+		t.Errorf("text output must contain the change of count:\n%s", b.String())
+	}
+
+	if err := diff.Write(&b, FormatPtQueryDigest); err == nil {
+		t.Error("expect error for pt format")
+	}
+}
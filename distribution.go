@@ -0,0 +1,75 @@
+package querydigest
+
+import (
+	"math"
+
+	"github.com/akito0107/querydigest/internal/ddsketch"
+)
+
+// distribution summarizes values in constant memory: count, sum, min, max and
+// variance are exact, quantiles are within ddsketch.RelativeAccuracy.
+// The fields are exported to be encodable by encoding/gob.
+type distribution struct {
+	Count int
+	Sum   float64
+	Min   float64
+	Max   float64
+	// Mean and M2 are the running mean and sum of squared deviations of Welford's algorithm.
+	Mean   float64
+	M2     float64
+	Sketch ddsketch.Sketch
+}
+
+func (d *distribution) add(v float64) {
+	if d.Count == 0 || v < d.Min {
+		d.Min = v
+	}
+	if d.Count == 0 || v > d.Max {
+		d.Max = v
+	}
+	d.Count++
+	d.Sum += v
+	delta := v - d.Mean
+	d.Mean += delta / float64(d.Count)
+	d.M2 += delta * (v - d.Mean)
+	d.Sketch.Add(v)
+}
+
+func (d *distribution) merge(o *distribution) {
+	if o.Count == 0 {
+		return
+	}
+	if d.Count == 0 {
+		*d = o.copy()
+		return
+	}
+	d.Min = math.Min(d.Min, o.Min)
+	d.Max = math.Max(d.Max, o.Max)
+
+	n := float64(d.Count + o.Count)
+	delta := o.Mean - d.Mean
+	d.M2 += o.M2 + delta*delta*float64(d.Count)*float64(o.Count)/n
+	d.Mean += delta * float64(o.Count) / n
+	d.Count += o.Count
+	d.Sum += o.Sum
+	d.Sketch.Merge(&o.Sketch)
+}
+
+func (d *distribution) copy() distribution {
+	c := *d
+	c.Sketch = *d.Sketch.Copy()
+	return c
+}
+
+// stddev returns the sample standard deviation, NaN for less than two values.
+func (d *distribution) stddev() float64 {
+	return math.Sqrt(d.M2 / float64(d.Count-1))
+}
+
+// quantile returns the approximate q-quantile, clamped to the exact min and max.
+func (d *distribution) quantile(q float64) float64 {
+	if d.Count == 0 {
+		return math.NaN()
+	}
+	return math.Max(d.Min, math.Min(d.Max, d.Sketch.Quantile(q)))
+}
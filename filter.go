@@ -0,0 +1,114 @@
+package querydigest
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Filter decides whether an event is aggregated. Filters run on the raw
+// events before the queries are normalized.
+type Filter interface {
+	Match(info *SlowQueryInfo) bool
+}
+
+type FilterFunc func(info *SlowQueryInfo) bool
+
+func (f FilterFunc) Match(info *SlowQueryInfo) bool {
+	return f(info)
+}
+
+// TimeRangeFilter matches events in [since, until). A zero bound is open.
+// Events without a timestamp never match.
+func TimeRangeFilter(since, until time.Time) Filter {
+	return FilterFunc(func(info *SlowQueryInfo) bool {
+		if info.Time.IsZero() {
+			return false
+		}
+		if !since.IsZero() && info.Time.Before(since) {
+			return false
+		}
+		if !until.IsZero() && !info.Time.Before(until) {
+			return false
+		}
+		return true
+	})
+}
+
+func MinQueryTimeFilter(min time.Duration) Filter {
+	return FilterFunc(func(info *SlowQueryInfo) bool {
+		return info.QueryTime.QueryTime >= min.Seconds()
+	})
+}
+
+func UserFilter(users ...string) Filter {
+	return stringFilter(users, func(info *SlowQueryInfo) string { return info.User })
+}
+
+func HostFilter(hosts ...string) Filter {
+	return stringFilter(hosts, func(info *SlowQueryInfo) string { return info.Host })
+}
+
+func DatabaseFilter(databases ...string) Filter {
+	return stringFilter(databases, func(info *SlowQueryInfo) string { return info.Database })
+}
+
+// StatementTypeFilter matches the leading keyword of the query, e.g. SELECT. It is case insensitive.
+func StatementTypeFilter(types ...string) Filter {
+	upper := make([]string, 0, len(types))
+	for _, t := range types {
+		upper = append(upper, strings.ToUpper(t))
+	}
+	return stringFilter(upper, func(info *SlowQueryInfo) string { return StatementType(info.RawQuery) })
+}
+
+func QueryRegexpFilter(re *regexp.Regexp) Filter {
+	return FilterFunc(func(info *SlowQueryInfo) bool {
+		return re.Match(info.RawQuery)
+	})
+}
+
+func stringFilter(values []string, field func(*SlowQueryInfo) string) Filter {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return FilterFunc(func(info *SlowQueryInfo) bool {
+		return set[field(info)]
+	})
+}
+
+// StatementType returns the upper-cased first keyword of the query,
+// skipping leading whitespace and comments.
+func StatementType(query []byte) string {
+	for {
+		query = bytes.TrimLeftFunc(query, unicode.IsSpace)
+		if bytes.HasPrefix(query, []byte("/*")) {
+			end := bytes.Index(query, []byte("*/"))
+			if end < 0 {
+				return ""
+			}
+			query = query[end+2:]
+			continue
+		}
+		if bytes.HasPrefix(query, []byte("#")) || (bytes.HasPrefix(query, []byte("--")) && len(query) > 2 && isLexSpace(query[2])) {
+			end := bytes.IndexByte(query, '\n')
+			if end < 0 {
+				return ""
+			}
+			query = query[end+1:]
+			continue
+		}
+		break
+	}
+
+	end := bytes.IndexFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if end < 0 {
+		end = len(query)
+	}
+	return strings.ToUpper(string(query[:end]))
+}
@@ -0,0 +1,87 @@
+package querydigest
+
+import (
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFilters(t *testing.T) {
+	info := &SlowQueryInfo{
+		RawQuery:  []byte("/* app:42 */ select * from users where id = 1;"),
+		QueryTime: QueryTime{QueryTime: 0.25},
+		Time:      time.Date(2020, 1, 17, 6, 0, 0, 0, time.UTC),
+		User:      "app",
+		Host:      "10.0.0.5",
+		Database:  "shop",
+	}
+
+	cases := []struct {
+		name   string
+		filter Filter
+		expect bool
+	}{
+		{name: "time in range", filter: TimeRangeFilter(time.Date(2020, 1, 17, 5, 0, 0, 0, time.UTC), time.Date(2020, 1, 17, 7, 0, 0, 0, time.UTC)), expect: true},
+		{name: "time open end", filter: TimeRangeFilter(time.Date(2020, 1, 17, 6, 0, 0, 0, time.UTC), time.Time{}), expect: true},
+		{name: "time until is exclusive", filter: TimeRangeFilter(time.Time{}, time.Date(2020, 1, 17, 6, 0, 0, 0, time.UTC)), expect: false},
+		{name: "min time", filter: MinQueryTimeFilter(200 * time.Millisecond), expect: true},
+		{name: "min time too long", filter: MinQueryTimeFilter(time.Second), expect: false},
+		{name: "user", filter: UserFilter("root", "app"), expect: true},
+		{name: "other user", filter: UserFilter("root"), expect: false},
+		{name: "host", filter: HostFilter("10.0.0.5"), expect: true},
+		{name: "database", filter: DatabaseFilter("blog"), expect: false},
+		{name: "statement type", filter: StatementTypeFilter("select"), expect: true},
+		{name: "other statement type", filter: StatementTypeFilter("INSERT", "UPDATE"), expect: false},
+		{name: "regexp", filter: QueryRegexpFilter(regexp.MustCompile(`from users\b`)), expect: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.filter.Match(info); got != c.expect {
+				t.Errorf("expect %v but %v", c.expect, got)
+			}
+		})
+	}
+}
+
+func TestStatementType(t *testing.T) {
+	cases := map[string]string{
+		"SELECT 1;":                                    "SELECT",
+		"  insert into t values (1);":                  "INSERT",
+		"/* comment */ UPDATE t SET a=1":               "UPDATE",
+		"(SELECT 1) UNION (SELECT 2)":                  "",
+		"# comment\nDELETE FROM t":                     "DELETE",
+		"-- comment\n  select 1":                       "SELECT",
+		"/* a */ -- b\n# c\nREPLACE INTO t VALUES (1)": "REPLACE",
+		"-- only a comment":                            "",
+		"--1":                                          "",
+	}
+	for src, expect := range cases {
+		if got := StatementType([]byte(src)); got != expect {
+			t.Errorf("StatementType(%q) = %q, expect %q", src, got, expect)
+		}
+	}
+}
+
+func TestStatementType_multiline(t *testing.T) {
+	f, err := os.Open("./testdata/mysql-slow.comment.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	scanner := NewSlowQueryScanner(f)
+	var types []string
+	for scanner.Next() {
+		types = append(types, StatementType(scanner.SlowQueryInfo().RawQuery))
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(types, []string{"SELECT", "UPDATE"}); diff != "" {
+		t.Errorf("diff: %s", diff)
+	}
+}
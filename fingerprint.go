@@ -0,0 +1,254 @@
+package querydigest
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// FingerprintMode selects how queries are normalized into their fingerprints.
+type FingerprintMode string
+
+const (
+	// FingerprintAST normalizes the syntax tree built by the SQL parser, see
+	// ReplaceWithZeroValue, falling back to LexicalFingerprint when it fails.
+	FingerprintAST FingerprintMode = "ast"
+	// FingerprintLexical uses LexicalFingerprint only, which is faster but
+	// does not resolve the tables for grouping by table.
+	FingerprintLexical FingerprintMode = "lexical"
+)
+
+func ParseFingerprintMode(s string) (FingerprintMode, error) {
+	switch m := FingerprintMode(s); m {
+	case FingerprintAST, FingerprintLexical:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown fingerprint mode: %s", s)
+}
+
+// LexicalFingerprint normalizes a query without parsing it, like pt-query-digest:
+// comments are stripped, strings, numbers, hex literals and NULL are replaced
+// with ?, IN lists and VALUES tuples are collapsed to (?+), LIMIT and OFFSET
+// are collapsed to a single ?, and everything else is lower-cased and
+// separated by single spaces. It never fails, so it also fingerprints the
+// queries the parser cannot.
+func LexicalFingerprint(src []byte) string {
+	if bytes.HasPrefix(src, adminCommandPrefix) {
+		return string(bytes.TrimSuffix(bytes.TrimSpace(src), []byte(";")))
+	}
+	return joinLexemes(collapseLexemes(lex(src)))
+}
+
+// lex splits the query into lower-cased words, ? for literals, operators and punctuation.
+func lex(src []byte) []string {
+	var lexemes []string
+	spaced := false
+	for i := 0; i < len(src); {
+		c := src[i]
+		if c == '(' {
+			if spaced && len(lexemes) > 0 {
+				lexemes = append(lexemes, spacedLParen)
+			} else {
+				lexemes = append(lexemes, "(")
+			}
+			spaced = false
+			i++
+			continue
+		}
+		spaced = false
+		switch {
+		case isLexSpace(c):
+			spaced = true
+			i++
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end < 0 {
+				return lexemes
+			}
+			spaced = true
+			i += 2 + end + 2
+		case c == '#' || (c == '-' && i+2 < len(src) && src[i+1] == '-' && isLexSpace(src[i+2])):
+			end := bytes.IndexByte(src[i:], '\n')
+			if end < 0 {
+				return lexemes
+			}
+			spaced = true
+			i += end
+		case c == '\'' || c == '"':
+			i = skipQuoted(src, i)
+			lexemes = append(lexemes, "?")
+		case c == '`':
+			j := len(src)
+			if end := bytes.IndexByte(src[i+1:], '`'); end >= 0 {
+				j = i + 1 + end + 1
+			}
+			lexemes = append(lexemes, strings.ToLower(string(src[i:j])))
+			i = j
+		case isDigit(c) || (c == '.' && i+1 < len(src) && isDigit(src[i+1])):
+			i = skipNumber(src, i)
+			lexemes = append(lexemes, "?")
+		case isWordByte(c):
+			j := i
+			for j < len(src) && isWordByte(src[j]) {
+				j++
+			}
+			word := strings.ToLower(string(src[i:j]))
+			if (word == "x" || word == "b" || word == "n") && j < len(src) && src[j] == '\'' {
+				// hex, bit and national string literals
+				i = skipQuoted(src, j)
+				lexemes = append(lexemes, "?")
+				continue
+			}
+			if word == "null" {
+				word = "?"
+			}
+			lexemes = append(lexemes, word)
+			i = j
+		case bytes.IndexByte([]byte("<>=!:|&"), c) >= 0:
+			j := i
+			for j < len(src) && bytes.IndexByte([]byte("<>=!:|&"), src[j]) >= 0 {
+				j++
+			}
+			lexemes = append(lexemes, string(src[i:j]))
+			i = j
+		default:
+			lexemes = append(lexemes, string(c))
+			i++
+		}
+	}
+	return lexemes
+}
+
+func isLexSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// isWordByte reports whether c is part of an identifier, keyword or variable,
+// including the bytes of multi-byte UTF-8 characters.
+func isWordByte(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || isDigit(c) || c == '_' || c == '$' || c == '@' || c >= 0x80
+}
+
+// skipQuoted returns the index after the string starting with the quote at i,
+// honoring backslash escapes and doubled quotes.
+func skipQuoted(src []byte, i int) int {
+	quote := src[i]
+	for i++; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case quote:
+			if i+1 < len(src) && src[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(src)
+}
+
+// skipNumber returns the index after the number starting at i, e.g. 42, 1.5e-3 or 0xFF.
+func skipNumber(src []byte, i int) int {
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case isWordByte(c) || c == '.':
+			i++
+		case (c == '-' || c == '+') && (src[i-1] == 'e' || src[i-1] == 'E'):
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// collapseLexemes collapses IN lists, VALUES tuples and LIMIT clauses and
+// drops the trailing semicolons.
+func collapseLexemes(lexemes []string) []string {
+	out := make([]string, 0, len(lexemes))
+	for i := 0; i < len(lexemes); i++ {
+		l := lexemes[i]
+		switch l {
+		case "in", "values", "value":
+			if end := placeholderTuples(lexemes, i+1); end > i+1 {
+				out = append(out, l, "(", "?+", ")")
+				i = end - 1
+				continue
+			}
+		case "limit":
+			if i+1 < len(lexemes) && lexemes[i+1] == "?" {
+				out = append(out, l, "?")
+				i++
+				if i+2 < len(lexemes) && (lexemes[i+1] == "," || lexemes[i+1] == "offset") && lexemes[i+2] == "?" {
+					i += 2
+				}
+				continue
+			}
+		}
+		out = append(out, l)
+	}
+	for len(out) > 0 && out[len(out)-1] == ";" {
+		out = out[:len(out)-1]
+	}
+	return out
+}
+
+// placeholderTuples returns the index after the comma separated tuples of
+// placeholders starting at i, e.g. (?, ?), (?, ?), or i if there are none.
+// Empty tuples, e.g. of `VALUES ()`, are not collapsed.
+func placeholderTuples(lexemes []string, i int) int {
+	end := i
+	for j := i; j < len(lexemes) && isLParen(lexemes[j]); {
+		k := j + 1
+		placeholders := false
+		for k < len(lexemes) && (lexemes[k] == "?" || lexemes[k] == ",") {
+			placeholders = placeholders || lexemes[k] == "?"
+			k++
+		}
+		if k >= len(lexemes) || lexemes[k] != ")" || !placeholders {
+			break
+		}
+		end = k + 1
+		j = end
+		if j+1 < len(lexemes) && lexemes[j] == "," && isLParen(lexemes[j+1]) {
+			j++
+		}
+	}
+	return end
+}
+
+// spacedLParen is a parenthesis preceded by whitespace in the query, which is
+// kept to tell e.g. `where (a = ?)` from a function call like `count(*)`.
+const spacedLParen = " ("
+
+func isLParen(l string) bool {
+	return l == "(" || l == spacedLParen
+}
+
+// joinLexemes separates the lexemes by single spaces, except inside
+// parentheses, before commas and around dots, e.g. `select t.a, f(?) from t`.
+func joinLexemes(lexemes []string) string {
+	var b strings.Builder
+	for i, l := range lexemes {
+		if i > 0 {
+			prev := lexemes[i-1]
+			switch {
+			case isLParen(prev) || prev == ".":
+			case l == ")" || l == "," || l == "." || l == "(":
+			default:
+				b.WriteByte(' ')
+			}
+		}
+		if l == spacedLParen {
+			l = "("
+		}
+		b.WriteString(l)
+	}
+	return b.String()
+}
@@ -0,0 +1,127 @@
+package querydigest
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLexicalFingerprint(t *testing.T) {
+	cases := []struct {
+		src    string
+		expect string
+	}{
+		{
+			src:    "SELECT * FROM items WHERE id IN (1, 2, 3) AND name = 'x' LIMIT 10, 20;",
+			expect: "select * from items where id in(?+) and name = ? limit ?",
+		},
+		{
+			src:    "select count(*) from `users` where (a=1 or b = 2.5e-3) and c is null -- trailing\n;",
+			expect: "select count(*) from `users` where (a = ? or b = ?) and c is ?",
+		},
+		{
+			src:    "INSERT INTO t (a, b) VALUES (1, 'a'), (2, 'b'),(3,'c');",
+			expect: "insert into t (a, b) values(?+)",
+		},
+		{
+			src:    "/* app:1 */ SELECT 0xFF, x'AB', @@version_comment, t.`col` FROM db.t # c\nWHERE s = \"it\\\"s\" LIMIT 5 OFFSET 10",
+			expect: "select ?, ?, @@version_comment, t.`col` from db.t where s = ? limit ?",
+		},
+		{
+			src:    "SELECT * FROM t WHERE id IN (SELECT id FROM u WHERE x IN ('a','b'))",
+			expect: "select * from t where id in (select id from u where x in(?+))",
+		},
+		{
+			src:    "SHOW TABLE STATUS LIKE 'it''s';",
+			expect: "show table status like ?",
+		},
+		{
+			src:    "SELECT * FROM items WHERE name = 'abc;",
+			expect: "select * from items where name = ?",
+		},
+		{
+			src:    "SELECT * FROM `items",
+			expect: "select * from `items",
+		},
+		{
+			src:    "INSERT INTO t VALUES ();",
+			expect: "insert into t values ()",
+		},
+		{
+			src:    "SELECT * FROM t WHERE id IN () AND x = 1",
+			expect: "select * from t where id in () and x = ?",
+		},
+		{
+			src:    "administrator command: Quit;",
+			expect: "administrator command: Quit",
+		},
+	}
+
+	for _, c := range cases {
+		if got := LexicalFingerprint([]byte(c.src)); got != c.expect {
+			t.Errorf("%s:\nexpect `%s`\nbut    `%s`", c.src, c.expect, got)
+		}
+	}
+}
+
+func TestAnalyze_fingerprint(t *testing.T) {
+	type summary struct {
+		Fingerprint string
+		Count       int
+	}
+	cases := []struct {
+		name            string
+		opts            []Option
+		expect          []summary
+		tokenizerErrors int
+	}{
+		{
+			name: "fallback",
+			expect: []summary{
+				{Fingerprint: "ALTER TABLE items ADD INDEX idx_category (category_id)", Count: 1},
+				{Fingerprint: "SHOW TABLES", Count: 1},
+				{Fingerprint: "UPDATE items SET WHERE id = 0", Count: 1},
+				{Fingerprint: "select * from items where name = ?", Count: 2},
+				{Fingerprint: "SELECT * FROM items WHERE id = 0", Count: 1},
+			},
+			tokenizerErrors: 2,
+		},
+		{
+			name: "lexical",
+			opts: []Option{WithFingerprint(FingerprintLexical)},
+			expect: []summary{
+				{Fingerprint: "alter table items add index idx_category (category_id)", Count: 1},
+				{Fingerprint: "show tables", Count: 1},
+				{Fingerprint: "update items set where id = ?", Count: 1},
+				{Fingerprint: "select * from items where name = ?", Count: 2},
+				{Fingerprint: "select * from items where id = ?", Count: 1},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := analyzeFile(t, "./testdata/mysql-slow.unparsable.log", c.opts...)
+			var got []summary
+			for _, s := range r.Summaries {
+				got = append(got, summary{Fingerprint: s.Fingerprint, Count: s.TotalQueryCount})
+			}
+			if diff := cmp.Diff(got, c.expect); diff != "" {
+				t.Errorf("diff: %s", diff)
+			}
+			var tokenizerErrors int
+			for _, u := range r.Unparsed {
+				if u.Reason == UnparsedTokenizerError {
+					tokenizerErrors = u.Count
+				}
+			}
+			if tokenizerErrors != c.tokenizerErrors {
+				t.Errorf("expect %d tokenizer errors but %d", c.tokenizerErrors, tokenizerErrors)
+			}
+		})
+	}
+
+	if _, err := ParseFingerprintMode("regexp"); err == nil {
+		t.Error("expect error for unknown mode")
+	}
+}
@@ -0,0 +1,101 @@
+package querydigest
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+// Follow opens the file at path and returns a reader which, like `tail -F`,
+// waits for the file to grow at EOF instead of returning io.EOF. When the path
+// is rotated to a new file or the file is truncated, reading continues from the
+// start of the new contents. The reader returns io.EOF once ctx is done.
+func Follow(ctx context.Context, path string, poll time.Duration) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &follower{ctx: ctx, path: path, poll: poll, f: f}, nil
+}
+
+type follower struct {
+	ctx    context.Context
+	path   string
+	poll   time.Duration
+	f      *os.File
+	offset int64
+}
+
+func (f *follower) Read(p []byte) (int, error) {
+	for {
+		n, err := f.f.Read(p)
+		f.offset += int64(n)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		// the current file is drained, so it is safe to switch to the rotated one
+		reopened, err := f.reopen()
+		if err != nil {
+			return 0, err
+		}
+		if reopened {
+			continue
+		}
+
+		t := time.NewTimer(f.poll)
+		select {
+		case <-f.ctx.Done():
+			t.Stop()
+			return 0, io.EOF
+		case <-t.C:
+		}
+	}
+}
+
+// reopen switches to the file at path when it is not the one being read,
+// and rewinds the current file when it has been truncated.
+func (f *follower) reopen() (bool, error) {
+	fi, err := os.Stat(f.path)
+	if os.IsNotExist(err) {
+		// rotated away, the new file is not created yet
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	cur, err := f.f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	if !os.SameFile(fi, cur) {
+		nf, err := os.Open(f.path)
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		f.f.Close()
+		f.f = nf
+		f.offset = 0
+		return true, nil
+	}
+	if fi.Size() < f.offset {
+		if _, err := f.f.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+		f.offset = 0
+		return true, nil
+	}
+	return false, nil
+}
+
+func (f *follower) Close() error {
+	return f.f.Close()
+}
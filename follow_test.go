@@ -0,0 +1,103 @@
+package querydigest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.String()
+}
+
+func TestFollow(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "slow.log")
+	if err := os.WriteFile(path, []byte("first\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r, err := Follow(ctx, path, 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var out syncBuffer
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(&out, r)
+		done <- err
+	}()
+
+	wait := func(expect string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for out.String() != expect {
+			if time.Now().After(deadline) {
+				t.Fatalf("expect %q but %q", expect, out.String())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	appendFile := func(s string) {
+		t.Helper()
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wait("first\n")
+
+	appendFile("appended\n")
+	wait("first\nappended\n")
+
+	// rotation
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile("rotated\n")
+	wait("first\nappended\nrotated\n")
+
+	// truncation
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendFile("new\n")
+	wait("first\nappended\nrotated\nnew\n")
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reader does not stop after the context is done")
+	}
+}
@@ -0,0 +1,186 @@
+package querydigest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+	// FormatPtQueryDigest mimics the default report of pt-query-digest.
+	FormatPtQueryDigest Format = "pt"
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatText, FormatJSON, FormatPtQueryDigest:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown output format: %s", s)
+}
+
+// Write renders the report to w in the given format.
+func (r *Report) Write(w io.Writer, format Format) error {
+	return r.WriteWidth(w, format, defaultWidth)
+}
+
+// WriteWidth is Write with the histograms of the text output sized to fit in
+// width columns, e.g. of the terminal, or in 80 if width is not positive.
+func (r *Report) WriteWidth(w io.Writer, format Format, width int) error {
+	switch format {
+	case FormatText, "":
+		print(w, r, width)
+		return nil
+	case FormatJSON:
+		return writeJSON(w, r)
+	case FormatPtQueryDigest:
+		return writePtQueryDigest(w, r)
+	}
+	return fmt.Errorf("unknown output format: %s", format)
+}
+
+// jsonSchemaVersion is bumped on every incompatible change of the JSON output.
+const jsonSchemaVersion = 1
+
+type jsonReport struct {
+	Version         int             `json:"version"`
+	GroupBy         []Dimension     `json:"group_by"`
+	TotalQueryTime  Seconds         `json:"total_query_time"`
+	TotalQueryCount int             `json:"total_query_count"`
+	UniqueQueries   int             `json:"unique_queries"`
+	Since           *time.Time      `json:"since,omitempty"`
+	Until           *time.Time      `json:"until,omitempty"`
+	ParseErrors     int             `json:"parse_errors"`
+	Unparsed        []*jsonUnparsed `json:"unparsed"`
+	Queries         []*jsonSummary  `json:"queries"`
+	Windows         []*jsonWindow   `json:"windows,omitempty"`
+}
+
+type jsonUnparsed struct {
+	Reason     UnparsedReason    `json:"reason"`
+	Count      int               `json:"count"`
+	QueryTime  Seconds           `json:"query_time"`
+	Percentage Count             `json:"percentage"`
+	Examples   []UnparsedExample `json:"examples"`
+}
+
+type jsonWindow struct {
+	Start           time.Time      `json:"start"`
+	End             time.Time      `json:"end"`
+	TotalQueryTime  Seconds        `json:"total_query_time"`
+	TotalQueryCount int            `json:"total_query_count"`
+	UniqueQueries   int            `json:"unique_queries"`
+	Queries         []*jsonSummary `json:"queries"`
+}
+
+type jsonSummary struct {
+	Rank        int               `json:"rank"`
+	QueryID     string            `json:"query_id"`
+	Fingerprint string            `json:"fingerprint,omitempty"`
+	Group       map[string]string `json:"group,omitempty"`
+	Example     string            `json:"example"`
+	Count       int               `json:"count"`
+	Percentage  Count             `json:"percentage"`
+	Stats       *SlowQueryStats   `json:"stats"`
+	Histogram   []HistogramBucket `json:"histogram"`
+	TimeSeries  *jsonTimeSeries   `json:"time_series,omitempty"`
+}
+
+type jsonTimeSeries struct {
+	Start  time.Time `json:"start"`
+	Bucket Seconds   `json:"bucket"`
+	Count  []int     `json:"count"`
+	Total  []Seconds `json:"total"`
+	P95    []Seconds `json:"p95"`
+}
+
+func writeJSON(w io.Writer, r *Report) error {
+	out := &jsonReport{
+		Version:         jsonSchemaVersion,
+		GroupBy:         r.GroupBy,
+		TotalQueryTime:  Seconds(r.TotalQueryTime),
+		TotalQueryCount: r.TotalQueryCount,
+		UniqueQueries:   r.UniqueQueries,
+		ParseErrors:     len(r.ParseErrors),
+		Queries:         jsonSummaries(r.GroupBy, r.Summaries, r.TotalQueryTime),
+	}
+	if !r.Since.IsZero() {
+		out.Since, out.Until = &r.Since, &r.Until
+	}
+	out.Unparsed = make([]*jsonUnparsed, 0, len(r.Unparsed))
+	for _, u := range r.Unparsed {
+		out.Unparsed = append(out.Unparsed, &jsonUnparsed{
+			Reason:     u.Reason,
+			Count:      u.Count,
+			QueryTime:  Seconds(u.QueryTime),
+			Percentage: Count(ptPercent(u.QueryTime, r.TotalQueryTime)),
+			Examples:   u.Examples,
+		})
+	}
+
+	for _, win := range r.Windows {
+		out.Windows = append(out.Windows, &jsonWindow{
+			Start:           win.Start,
+			End:             win.End,
+			TotalQueryTime:  Seconds(win.TotalQueryTime),
+			TotalQueryCount: win.TotalQueryCount,
+			UniqueQueries:   win.UniqueQueries,
+			Queries:         jsonSummaries(r.GroupBy, win.Summaries, win.TotalQueryTime),
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func jsonSummaries(groupBy GroupBy, summaries []*SlowQuerySummary, totalTime float64) []*jsonSummary {
+	out := make([]*jsonSummary, 0, len(summaries))
+	for i, s := range summaries {
+		out = append(out, &jsonSummary{
+			Rank:        i + 1,
+			QueryID:     s.QueryID(),
+			Fingerprint: s.Fingerprint,
+			Group:       jsonGroup(groupBy, s.Group),
+			Example:     s.RowSample,
+			Count:       s.TotalQueryCount,
+			Percentage:  Count(s.TotalTime / totalTime * 100),
+			Stats:       s.Stats(),
+			Histogram:   s.Histogram().Buckets(),
+			TimeSeries:  newJSONTimeSeries(s.TimeSeries()),
+		})
+	}
+	return out
+}
+
+// jsonGroup maps the dimensions other than fingerprint to their values.
+func jsonGroup(groupBy GroupBy, values []string) map[string]string {
+	if len(values) == 0 {
+		return nil
+	}
+	group := make(map[string]string, len(values))
+	for i, d := range groupBy {
+		if d != DimensionFingerprint && i < len(values) {
+			group[string(d)] = values[i]
+		}
+	}
+	return group
+}
+
+func newJSONTimeSeries(ts *TimeSeries) *jsonTimeSeries {
+	if ts == nil {
+		return nil
+	}
+	return &jsonTimeSeries{
+		Start:  ts.Start,
+		Bucket: Seconds(ts.Bucket.Seconds()),
+		Count:  ts.Count,
+		Total:  ts.Total,
+		P95:    ts.P95,
+	}
+}
@@ -0,0 +1,78 @@
+package querydigest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestReport_Write_json(t *testing.T) {
+	f, err := os.Open("./testdata/mysql-slow.createtable.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	report, err := Analyze(context.Background(), f, WithFilter(StatementTypeFilter("SELECT")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := report.Write(&b, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	var out struct {
+		Version         int `json:"version"`
+		TotalQueryCount int `json:"total_query_count"`
+		Queries         []struct {
+			Rank    int    `json:"rank"`
+			Example string `json:"example"`
+			Count   int    `json:"count"`
+			Stats   struct {
+				ExecTime struct {
+					Total  float64  `json:"total"`
+					Stddev *float64 `json:"stddev"`
+				} `json:"exec_time"`
+			} `json:"stats"`
+			Histogram []struct {
+				Label string `json:"label"`
+				Count int    `json:"count"`
+			} `json:"histogram"`
+		} `json:"queries"`
+	}
+	if err := json.Unmarshal(b.Bytes(), &out); err != nil {
+		t.Fatalf("invalid json: %v\n%s", err, b.String())
+	}
+
+	if out.Version != jsonSchemaVersion {
+		t.Errorf("unexpected version %d", out.Version)
+	}
+	if out.TotalQueryCount != 2 || len(out.Queries) != 2 {
+		t.Fatalf("unexpected counts: %d queries of %d", len(out.Queries), out.TotalQueryCount)
+	}
+
+	q := out.Queries[0]
+	if q.Rank != 1 || q.Example != "select @@version_comment limit 1;" || q.Count != 1 {
+		t.Errorf("unexpected query: %+v", q)
+	}
+	if q.Stats.ExecTime.Total != 0.000126 {
+		t.Errorf("unexpected exec time total %f", q.Stats.ExecTime.Total)
+	}
+	if q.Stats.ExecTime.Stddev != nil {
+		t.Errorf("stddev of a single sample should be null but %f", *q.Stats.ExecTime.Stddev)
+	}
+	var hist int
+	for _, h := range q.Histogram {
+		hist += h.Count
+		if h.Label == "100us" && h.Count != 1 {
+			t.Errorf("expect 1 event in 100us bucket but %d", h.Count)
+		}
+	}
+	if hist != 1 {
+		t.Errorf("expect 1 event in histogram but %d", hist)
+	}
+}
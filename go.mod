@@ -1,13 +1,25 @@
 module github.com/akito0107/querydigest
 
-go 1.13
+go 1.22
 
 require (
 	github.com/akito0107/xsqlparser v1.0.0-alpha.6
-	github.com/go-openapi/strfmt v0.19.3 // indirect
 	github.com/google/go-cmp v0.4.0
 	github.com/jedib0t/go-pretty v4.3.0+incompatible
-	github.com/mattn/go-runewidth v0.0.7 // indirect
+	github.com/klauspost/compress v1.18.0
 	github.com/stuartcarnie/go-simd v0.0.0-20181029150639-4ad6cd8935a6
-	gonum.org/v1/gonum v0.6.1
+	github.com/ulikunitz/xz v0.5.15
+	golang.org/x/term v0.21.0
+)
+
+require (
+	github.com/asaskevich/govalidator v0.0.0-20190424111038-f61b66f89f4a // indirect
+	github.com/go-openapi/errors v0.19.2 // indirect
+	github.com/go-openapi/strfmt v0.19.3 // indirect
+	github.com/go-stack/stack v1.8.0 // indirect
+	github.com/mattn/go-runewidth v0.0.7 // indirect
+	github.com/mitchellh/mapstructure v1.1.2 // indirect
+	go.mongodb.org/mongo-driver v1.0.3 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/xerrors v0.0.0-20191204190536-9bdfabe68543 // indirect
 )
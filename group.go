@@ -0,0 +1,140 @@
+package querydigest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dimension is an attribute of the events the summaries are grouped by.
+type Dimension string
+
+const (
+	DimensionFingerprint   Dimension = "fingerprint"
+	DimensionUser          Dimension = "user"
+	DimensionHost          Dimension = "host"
+	DimensionDatabase      Dimension = "db"
+	DimensionTable         Dimension = "table"
+	DimensionStatementType Dimension = "type"
+	DimensionFile          Dimension = "file"
+)
+
+var dimensions = []Dimension{
+	DimensionFingerprint,
+	DimensionUser,
+	DimensionHost,
+	DimensionDatabase,
+	DimensionTable,
+	DimensionStatementType,
+	DimensionFile,
+}
+
+// GroupBy is the list of dimensions which identifies a summary.
+type GroupBy []Dimension
+
+var defaultGroupBy = GroupBy{DimensionFingerprint}
+
+// ParseGroupBy parses a comma separated list of dimensions, e.g. `fingerprint,user`.
+func ParseGroupBy(s string) (GroupBy, error) {
+	var g GroupBy
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		var dim Dimension
+		for _, d := range dimensions {
+			if string(d) == name {
+				dim = d
+			}
+		}
+		if dim == "" {
+			return nil, fmt.Errorf("unknown group-by dimension: %s", name)
+		}
+		if g.has(dim) {
+			return nil, fmt.Errorf("duplicated group-by dimension: %s", name)
+		}
+		g = append(g, dim)
+	}
+	return g, nil
+}
+
+func (g GroupBy) has(dim Dimension) bool {
+	for _, d := range g {
+		if d == dim {
+			return true
+		}
+	}
+	return false
+}
+
+func (g GroupBy) isFingerprint() bool {
+	return len(g) == 1 && g[0] == DimensionFingerprint
+}
+
+func (g GroupBy) String() string {
+	names := make([]string, 0, len(g))
+	for _, d := range g {
+		names = append(names, string(d))
+	}
+	return strings.Join(names, ",")
+}
+
+// groups returns the group values of the event. An event referencing
+// several tables belongs to one group per table.
+func (g GroupBy) groups(info *SlowQueryInfo) [][]string {
+	groups := [][]string{make([]string, 0, len(g))}
+	for _, d := range g {
+		values := d.values(info)
+		next := make([][]string, 0, len(groups)*len(values))
+		for _, group := range groups {
+			for _, v := range values {
+				next = append(next, append(group[:len(group):len(group)], v))
+			}
+		}
+		groups = next
+	}
+	return groups
+}
+
+func (d Dimension) values(info *SlowQueryInfo) []string {
+	switch d {
+	case DimensionUser:
+		return []string{info.User}
+	case DimensionHost:
+		return []string{info.Host}
+	case DimensionDatabase:
+		return []string{info.Database}
+	case DimensionTable:
+		if len(info.Tables) == 0 {
+			return []string{""}
+		}
+		return info.Tables
+	case DimensionStatementType:
+		return []string{StatementType(info.RawQuery)}
+	case DimensionFile:
+		return []string{info.Source}
+	default:
+		return []string{info.ParsedQuery}
+	}
+}
+
+// groupKey joins the group values into the key of the Summarizer map.
+func groupKey(group []string) string {
+	if len(group) == 1 {
+		return group[0]
+	}
+	return strings.Join(group, "\x1f")
+}
+
+// label formats the group values of a summary, e.g. `user=app, table=items`.
+func (g GroupBy) label(group []string) string {
+	parts := make([]string, 0, len(g))
+	for i, d := range g {
+		if d == DimensionFingerprint || i >= len(group) {
+			continue
+		}
+		v := group[i]
+		if v == "" {
+			v = "-"
+		}
+		parts = append(parts, fmt.Sprintf("%s=%s", d, v))
+	}
+	return strings.Join(parts, ", ")
+}
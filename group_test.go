@@ -0,0 +1,106 @@
+package querydigest
+
+import (
+	"context"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseGroupBy(t *testing.T) {
+	cases := []struct {
+		src     string
+		expect  GroupBy
+		wantErr bool
+	}{
+		{src: "fingerprint", expect: GroupBy{DimensionFingerprint}},
+		{src: "fingerprint, user", expect: GroupBy{DimensionFingerprint, DimensionUser}},
+		{src: "table", expect: GroupBy{DimensionTable}},
+		{src: "user,user", wantErr: true},
+		{src: "schema", wantErr: true},
+	}
+
+	for _, c := range cases {
+		g, err := ParseGroupBy(c.src)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: expect error", c.src)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.src, err)
+			continue
+		}
+		if diff := cmp.Diff(g, c.expect); diff != "" {
+			t.Errorf("%s: diff: %s", c.src, diff)
+		}
+	}
+}
+
+func TestAnalyze_groupBy(t *testing.T) {
+	type group struct {
+		Group []string
+		Count int
+		Time  float64
+	}
+
+	cases := []struct {
+		name    string
+		groupBy GroupBy
+		expect  []group
+	}{
+		{
+			name:    "user",
+			groupBy: GroupBy{DimensionUser},
+			expect: []group{
+				{Group: []string{"app"}, Count: 2, Time: 0.3},
+				{Group: []string{"batch"}, Count: 1, Time: 0.3},
+			},
+		},
+		{
+			name:    "table",
+			groupBy: GroupBy{DimensionTable},
+			expect: []group{
+				{Group: []string{"items"}, Count: 2, Time: 0.4},
+				{Group: []string{"users"}, Count: 2, Time: 0.3},
+			},
+		},
+		{
+			name:    "type and db",
+			groupBy: GroupBy{DimensionStatementType, DimensionDatabase},
+			expect: []group{
+				{Group: []string{"SELECT", "shop"}, Count: 2, Time: 0.3},
+				{Group: []string{"UPDATE", "shop"}, Count: 1, Time: 0.3},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			f, err := os.Open("./testdata/mysql-slow.group.log")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			report, err := Analyze(context.Background(), f, WithGroupBy(c.groupBy), WithSortKey(SortByCount))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []group
+			for _, s := range report.Summaries {
+				got = append(got, group{Group: s.Group, Count: s.TotalQueryCount, Time: math.Round(s.TotalTime*1000) / 1000})
+			}
+			if diff := cmp.Diff(got, c.expect); diff != "" {
+				t.Errorf("diff: %s", diff)
+			}
+			if report.TotalQueryCount != 3 {
+				t.Errorf("every event must be counted once in total but %d", report.TotalQueryCount)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// Package ddsketch implements DDSketch, a mergeable quantile sketch with a
+// relative error guarantee: every quantile it returns is within
+// RelativeAccuracy of a value at that rank, using memory logarithmic in the
+// range of the values instead of linear in their number.
+package ddsketch
+
+import "math"
+
+// RelativeAccuracy bounds the relative error of the quantiles.
+const RelativeAccuracy = 0.01
+
+// minIndexable is the smallest value counted in a bin; smaller ones are counted as zero.
+const minIndexable = 1e-9
+
+var (
+	gamma    = (1 + RelativeAccuracy) / (1 - RelativeAccuracy)
+	logGamma = math.Log(gamma)
+)
+
+// Sketch counts non-negative values in bins of logarithmically growing size.
+// The fields are exported to be encodable by encoding/gob only.
+type Sketch struct {
+	// Offset is the index of the bin counted by Bins[0].
+	Offset int
+	Bins   []uint64
+	// Zeros counts the values too small to be indexed, including negative ones.
+	Zeros uint64
+	Count uint64
+}
+
+func index(v float64) int {
+	return int(math.Ceil(math.Log(v) / logGamma))
+}
+
+// value returns the value of the bin which is within RelativeAccuracy of any value counted in it.
+func value(i int) float64 {
+	return 2 * math.Pow(gamma, float64(i)) / (gamma + 1)
+}
+
+func (s *Sketch) Add(v float64) {
+	s.Count++
+	if !(v >= minIndexable) {
+		s.Zeros++
+		return
+	}
+	i := index(v)
+	s.grow(i, i)
+	s.Bins[i-s.Offset]++
+}
+
+// Merge adds the values counted by o to s.
+func (s *Sketch) Merge(o *Sketch) {
+	s.Count += o.Count
+	s.Zeros += o.Zeros
+	if len(o.Bins) == 0 {
+		return
+	}
+	s.grow(o.Offset, o.Offset+len(o.Bins)-1)
+	for j, c := range o.Bins {
+		s.Bins[o.Offset+j-s.Offset] += c
+	}
+}
+
+// grow makes the bins cover the indexes from min to max.
+func (s *Sketch) grow(min, max int) {
+	if len(s.Bins) == 0 {
+		s.Offset = min
+		s.Bins = make([]uint64, max-min+1)
+		return
+	}
+	if min < s.Offset {
+		bins := make([]uint64, s.Offset-min+len(s.Bins))
+		copy(bins[s.Offset-min:], s.Bins)
+		s.Bins = bins
+		s.Offset = min
+	}
+	if n := max - s.Offset + 1 - len(s.Bins); n > 0 {
+		s.Bins = append(s.Bins, make([]uint64, n)...)
+	}
+}
+
+// Quantile returns the q-quantile of the values, 0 <= q <= 1, by the nearest-rank
+// method, i.e. the ceil(q * Count)-th smallest value, or NaN when there are none.
+func (s *Sketch) Quantile(q float64) float64 {
+	if s.Count == 0 {
+		return math.NaN()
+	}
+	rank := math.Max(math.Ceil(q*float64(s.Count)), 1)
+	n := float64(s.Zeros)
+	if rank <= n {
+		return 0
+	}
+	for j, c := range s.Bins {
+		n += float64(c)
+		if n >= rank {
+			return value(s.Offset + j)
+		}
+	}
+	return value(s.Offset + len(s.Bins) - 1)
+}
+
+// Copy returns a deep copy of s.
+func (s *Sketch) Copy() *Sketch {
+	c := *s
+	c.Bins = append([]uint64(nil), s.Bins...)
+	return &c
+}
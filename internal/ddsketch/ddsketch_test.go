@@ -0,0 +1,79 @@
+package ddsketch
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSketch_Quantile(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var values []float64
+	var s Sketch
+	for i := 0; i < 100000; i++ {
+		// log-normal, like query times
+		v := math.Exp(r.NormFloat64()*2 - 5)
+		values = append(values, v)
+		s.Add(v)
+	}
+	sort.Float64s(values)
+
+	for _, q := range []float64{0, 0.5, 0.9, 0.95, 0.99, 1} {
+		expect := values[int(math.Max(math.Ceil(q*float64(len(values))), 1))-1]
+		got := s.Quantile(q)
+		if math.Abs(got-expect) > expect*RelativeAccuracy {
+			t.Errorf("q=%v: expect %v within %v but %v", q, expect, RelativeAccuracy, got)
+		}
+	}
+	if len(s.Bins) > 2000 {
+		t.Errorf("too many bins: %d", len(s.Bins))
+	}
+}
+
+func TestSketch_zero(t *testing.T) {
+	var s Sketch
+	if !math.IsNaN(s.Quantile(0.5)) {
+		t.Errorf("expect NaN for empty sketch but %v", s.Quantile(0.5))
+	}
+	s.Add(0)
+	s.Add(0)
+	s.Add(10)
+	if got := s.Quantile(0.5); got != 0 {
+		t.Errorf("expect 0 but %v", got)
+	}
+	if got := s.Quantile(1); math.Abs(got-10) > 10*RelativeAccuracy {
+		t.Errorf("expect 10 but %v", got)
+	}
+}
+
+func TestSketch_Merge(t *testing.T) {
+	var a, b, all Sketch
+	for i := 1; i <= 1000; i++ {
+		v := float64(i)
+		if i%2 == 0 {
+			a.Add(v)
+		} else {
+			b.Add(v / 1000)
+		}
+		if i%2 == 0 {
+			all.Add(v)
+		} else {
+			all.Add(v / 1000)
+		}
+	}
+	merged := a.Copy()
+	merged.Merge(&b)
+
+	if merged.Count != all.Count || merged.Zeros != all.Zeros {
+		t.Fatalf("expect count %d but %d", all.Count, merged.Count)
+	}
+	for _, q := range []float64{0, 0.25, 0.5, 0.95, 1} {
+		if merged.Quantile(q) != all.Quantile(q) {
+			t.Errorf("q=%v: expect %v but %v", q, all.Quantile(q), merged.Quantile(q))
+		}
+	}
+	if a.Count != 500 {
+		t.Errorf("merging must not modify the copied sketch: %d", a.Count)
+	}
+}
@@ -0,0 +1,121 @@
+package querydigest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/akito0107/xsqlparser/sqlast"
+)
+
+// KeywordCase is the case the keywords of the fingerprints are normalized to.
+type KeywordCase string
+
+const (
+	KeywordUpper KeywordCase = "upper"
+	KeywordLower KeywordCase = "lower"
+)
+
+// Normalizer configures how the SQL parser normalizes queries into their
+// fingerprints. The zero value replaces the literals with zero values, like
+// ReplaceWithZeroValue.
+type Normalizer struct {
+	// Placeholders replaces the literals with ? instead of zero values, and
+	// IN lists and the rows of VALUES with (?+), like pt-query-digest.
+	Placeholders bool
+	// KeywordCase normalizes the case of the keywords, including the function
+	// names known to the parser, e.g. count(*) and COUNT(*). The keywords are
+	// kept as the parser prints them when empty, and upper-cased like by
+	// ReplaceWithZeroValue for the statements the parser cannot parse.
+	KeywordCase KeywordCase
+	// Unquote strips the backticks quoting identifiers, e.g. `users`.
+	Unquote bool
+	// StripDatabase drops the database qualifiers of table names, e.g. db.users becomes users.
+	// Only applies to the queries the parser can parse.
+	StripDatabase bool
+	// CollapseLimit drops the offset of LIMIT clauses, e.g. LIMIT 20, 10 becomes LIMIT 0.
+	CollapseLimit bool
+}
+
+// ParseNormalizer parses a comma separated list of normalization options:
+// placeholders, upper, lower, unquote, strip-db and collapse-limit.
+// An empty string is the zero Normalizer.
+func ParseNormalizer(s string) (Normalizer, error) {
+	var n Normalizer
+	if s == "" {
+		return n, nil
+	}
+	for _, f := range strings.Split(s, ",") {
+		switch strings.TrimSpace(f) {
+		case "placeholders":
+			n.Placeholders = true
+		case "upper":
+			n.KeywordCase = KeywordUpper
+		case "lower":
+			n.KeywordCase = KeywordLower
+		case "unquote":
+			n.Unquote = true
+		case "strip-db":
+			n.StripDatabase = true
+		case "collapse-limit":
+			n.CollapseLimit = true
+		default:
+			return Normalizer{}, fmt.Errorf("unknown normalize option: %s", f)
+		}
+	}
+	return n, nil
+}
+
+// Normalize returns the fingerprint of the query src. Statements the parser
+// cannot parse are normalized token by token; an error is only returned when
+// the query cannot be tokenized or the parser panics.
+func (n Normalizer) Normalize(src []byte) (string, error) {
+	res, _, err := n.normalize(src, nil)
+	if res != "" {
+		return res, nil
+	}
+	return res, err
+}
+
+// placeholderList replaces IN lists and the rows of VALUES with Placeholders.
+var placeholderList = sqlast.NewIdent("?+")
+
+// rewritesTokens reports whether the SQL printed by the parser needs to be
+// rewritten token by token for the options of n.
+func (n Normalizer) rewritesTokens() bool {
+	return n.Placeholders || n.KeywordCase != "" || n.Unquote || n.CollapseLimit
+}
+
+// literal returns the replacement of a literal, its zero value unless Placeholders is set.
+func (n Normalizer) literal(zero string) string {
+	if n.Placeholders {
+		return "?"
+	}
+	return zero
+}
+
+// mysqlKeywords are the MySQL keywords and functions the parser does not know,
+// whose case is normalized too with KeywordCase.
+var mysqlKeywords = map[string]bool{
+	"ANALYZE": true, "AUTOCOMMIT": true, "COLUMNS": true, "CONCAT": true, "DATABASES": true,
+	"DELAYED": true, "DIV": true, "DUPLICATE": true, "ERRORS": true, "EXPLAIN": true,
+	"FORCE": true, "FOUND_ROWS": true, "HIGH_PRIORITY": true, "IF": true, "IFNULL": true,
+	"IGNORE": true, "INDEX": true, "LOCK": true, "LOW_PRIORITY": true, "MODE": true,
+	"NAMES": true, "NOW": true, "OPTIMIZE": true, "PROCESSLIST": true, "REGEXP": true,
+	"RENAME": true, "REPLACE": true, "SESSION": true, "SHARE": true, "SHOW": true,
+	"SQL_CALC_FOUND_ROWS": true, "SQL_NO_CACHE": true, "STATUS": true, "STRAIGHT_JOIN": true,
+	"TABLES": true, "TRANSACTION": true, "UNLOCK": true, "USE": true, "VARIABLES": true,
+	"WARNINGS": true, "XOR": true,
+}
+
+func (n Normalizer) keyword(kw string) string {
+	if n.KeywordCase == KeywordLower {
+		return strings.ToLower(kw)
+	}
+	return kw
+}
+
+func (n Normalizer) stripDatabase(name *sqlast.ObjectName) {
+	if n.StripDatabase && name != nil && len(name.Idents) > 1 {
+		name.Idents = name.Idents[len(name.Idents)-1:]
+	}
+}
@@ -0,0 +1,129 @@
+package querydigest
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseNormalizer(t *testing.T) {
+	cases := []struct {
+		src     string
+		expect  Normalizer
+		wantErr bool
+	}{
+		{src: "", expect: Normalizer{}},
+		{src: "placeholders, lower", expect: Normalizer{Placeholders: true, KeywordCase: KeywordLower}},
+		{src: "upper,unquote,strip-db,collapse-limit", expect: Normalizer{KeywordCase: KeywordUpper, Unquote: true, StripDatabase: true, CollapseLimit: true}},
+		{src: "placeholder", wantErr: true},
+	}
+
+	for _, c := range cases {
+		n, err := ParseNormalizer(c.src)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: expect error", c.src)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.src, err)
+			continue
+		}
+		if diff := cmp.Diff(n, c.expect); diff != "" {
+			t.Errorf("%s: diff: %s", c.src, diff)
+		}
+	}
+}
+
+func TestNormalizer_Normalize(t *testing.T) {
+	cases := []struct {
+		normalizer Normalizer
+		src        string
+		expect     string
+	}{
+		{
+			normalizer: Normalizer{},
+			src:        "SELECT * FROM `db`.`items` WHERE id IN (1, 2) AND price > -1.5 LIMIT 10 OFFSET 20;",
+			expect:     "SELECT * FROM `db`.`items` WHERE id IN () AND price > - 0 LIMIT 0 OFFSET 0",
+		},
+		{
+			normalizer: Normalizer{Placeholders: true},
+			src:        "SELECT * FROM items WHERE id IN (1, 2) AND price > -1.5 AND name = 'a' AND sold = true AND created_at > '2020-01-01 00:00:00';",
+			expect:     "SELECT * FROM items WHERE id IN (?+) AND price > ? AND name = ? AND sold = ? AND created_at > ?",
+		},
+		{
+			normalizer: Normalizer{Placeholders: true},
+			src:        "INSERT INTO items (id, name) VALUES (1, 'a'), (2, NOW()) ON DUPLICATE KEY UPDATE name = VALUES(name);",
+			expect:     "INSERT INTO items (id, name) VALUES (?+) ON DUPLICATE KEY UPDATE name = VALUES(name)",
+		},
+		{
+			normalizer: Normalizer{KeywordCase: KeywordLower},
+			src:        "SELECT COUNT(*) FROM items WHERE now() > created_at;",
+			expect:     "select count(*) from items where now() > created_at",
+		},
+		{
+			normalizer: Normalizer{KeywordCase: KeywordUpper},
+			src:        "select count(*) from items where now() > created_at;",
+			expect:     "SELECT COUNT(*) FROM items WHERE NOW() > created_at",
+		},
+		{
+			normalizer: Normalizer{Unquote: true, StripDatabase: true},
+			src:        "SELECT `i`.`id` FROM `db`.`items` AS `i` JOIN users ON users.id = `i`.`user_id`;",
+			expect:     "SELECT i.id FROM items AS i JOIN users ON users.id = i.user_id",
+		},
+		{
+			normalizer: Normalizer{StripDatabase: true},
+			src:        "DELETE FROM isucari.items WHERE id = 1;",
+			expect:     "DELETE FROM items WHERE id = 0",
+		},
+		{
+			normalizer: Normalizer{CollapseLimit: true},
+			src:        "SELECT * FROM items WHERE id > 1 LIMIT 10 OFFSET 20;",
+			expect:     "SELECT * FROM items WHERE id > 0 LIMIT 0",
+		},
+		{
+			normalizer: Normalizer{Placeholders: true, KeywordCase: KeywordLower, Unquote: true, CollapseLimit: true},
+			src:        "SHOW TABLE STATUS LIKE 'items';",
+			expect:     "show table status like ?",
+		},
+		{
+			normalizer: Normalizer{Placeholders: true, CollapseLimit: true},
+			src:        "REPLACE INTO `configs` (name, val) VALUES ('a', 1), ('b', 2) LIMIT 1, 2;",
+			expect:     "REPLACE INTO `configs` (name, val) VALUES (?+) LIMIT ?",
+		},
+		{
+			normalizer: Normalizer{Placeholders: true},
+			src:        "INSERT IGNORE INTO items (id, name) VALUES (1, 'a'), (2, 'b');",
+			expect:     "INSERT IGNORE INTO items (id, name) VALUES (?+)",
+		},
+		{
+			normalizer: Normalizer{Placeholders: true},
+			src:        "select count(*) from items where id > 1;",
+			expect:     "SELECT count(*) FROM items WHERE id > ?",
+		},
+		{
+			normalizer: Normalizer{CollapseLimit: true},
+			src:        "select count(*) from items where id > 1 LIMIT 10, 20;",
+			expect:     "SELECT count(*) FROM items WHERE id > 0 LIMIT 0",
+		},
+	}
+
+	for _, c := range cases {
+		got, err := c.normalizer.Normalize([]byte(c.src))
+		if err != nil {
+			t.Errorf("%s: %v", c.src, err)
+			continue
+		}
+		if got != c.expect {
+			t.Errorf("%+v %s:\nexpect `%s`\nbut    `%s`", c.normalizer, c.src, c.expect, got)
+		}
+	}
+}
+
+func TestAnalyze_normalizer(t *testing.T) {
+	r := analyzeFile(t, "./testdata/mysql-slow.group.log", WithNormalizer(Normalizer{Placeholders: true, KeywordCase: KeywordLower}))
+	if got := r.Summaries[0].Fingerprint; got != "update items set price = ? where id = ?" {
+		t.Errorf("unexpected fingerprint: %s", got)
+	}
+}
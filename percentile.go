@@ -0,0 +1,77 @@
+package querydigest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Percentiles are the percentiles computed in the stats, e.g. 99.9 for the 99.9th percentile.
+type Percentiles []float64
+
+// DefaultPercentiles are the 95th percentile and the median.
+var DefaultPercentiles = Percentiles{95, 50}
+
+// ParsePercentiles parses a comma separated list of percentiles, e.g. `50,90,95,99,99.9`.
+func ParsePercentiles(s string) (Percentiles, error) {
+	var ps Percentiles
+	for _, f := range strings.Split(s, ",") {
+		p, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid percentile: %s", f)
+		}
+		if !(p > 0 && p <= 100) {
+			return nil, fmt.Errorf("percentile out of range (0, 100]: %s", f)
+		}
+		for _, q := range ps {
+			if q == p {
+				return nil, fmt.Errorf("duplicated percentile: %s", f)
+			}
+		}
+		ps = append(ps, p)
+	}
+	return ps.columns(), nil
+}
+
+// columns orders the percentiles like the columns of the stats table:
+// ascending, except that the median comes last, after the stddev.
+func (ps Percentiles) columns() Percentiles {
+	c := append(Percentiles(nil), ps...)
+	sort.SliceStable(c, func(i, j int) bool {
+		if c[i] == 50 || c[j] == 50 {
+			return c[j] == 50 && c[i] != 50
+		}
+		return c[i] < c[j]
+	})
+	return c
+}
+
+func percentileKey(p float64) string {
+	return strconv.FormatFloat(p, 'f', -1, 64)
+}
+
+func percentileLabel(p float64) string {
+	if p == 50 {
+		return "median"
+	}
+	return percentileKey(p) + "%"
+}
+
+// header returns the column names of the stats table.
+func (ps Percentiles) header() []interface{} {
+	row := []interface{}{"Attribute", "total", "min", "max", "avg"}
+	var median bool
+	for _, p := range ps {
+		if p == 50 {
+			median = true
+			continue
+		}
+		row = append(row, percentileLabel(p))
+	}
+	row = append(row, "stddev")
+	if median {
+		row = append(row, "median")
+	}
+	return row
+}
@@ -0,0 +1,90 @@
+package querydigest
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParsePercentiles(t *testing.T) {
+	cases := []struct {
+		src     string
+		expect  Percentiles
+		wantErr bool
+	}{
+		{src: "95,50", expect: Percentiles{95, 50}},
+		{src: "50, 90, 95, 99, 99.9", expect: Percentiles{90, 95, 99, 99.9, 50}},
+		{src: "99.9,99", expect: Percentiles{99, 99.9}},
+		{src: "100", expect: Percentiles{100}},
+		{src: "0", wantErr: true},
+		{src: "101", wantErr: true},
+		{src: "99,99", wantErr: true},
+		{src: "p99", wantErr: true},
+	}
+
+	for _, c := range cases {
+		ps, err := ParsePercentiles(c.src)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: expect error", c.src)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.src, err)
+			continue
+		}
+		if diff := cmp.Diff(ps, c.expect); diff != "" {
+			t.Errorf("%s: diff: %s", c.src, diff)
+		}
+	}
+}
+
+func TestAnalyze_percentiles(t *testing.T) {
+	r := analyzeFile(t, "./testdata/mysql-slow.timeseries.log", WithPercentiles(Percentiles{90, 99.9, 50}))
+	stats := r.Summaries[0].Stats()
+
+	header := strings.SplitN(stats.String(), "\n", 3)[1]
+	fields := strings.Fields(strings.NewReplacer("|", " ").Replace(header))
+	if diff := cmp.Diff(fields, []string{"ATTRIBUTE", "TOTAL", "MIN", "MAX", "AVG", "90%", "99.9%", "STDDEV", "MEDIAN"}); diff != "" {
+		t.Errorf("header diff: %s", diff)
+	}
+
+	b, err := json.Marshal(stats.ExecTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	dec := json.NewDecoder(strings.NewReader(string(b)))
+	dec.Token()
+	for dec.More() {
+		key, _ := dec.Token()
+		keys = append(keys, key.(string))
+		var v interface{}
+		dec.Decode(&v)
+	}
+	if diff := cmp.Diff(keys, []string{"total", "min", "max", "avg", "p90", "p99.9", "stddev", "median"}); diff != "" {
+		t.Errorf("json keys diff: %s", diff)
+	}
+
+	if stats.ExecTime.P95 == 0 || stats.ExecTime.Median != stats.ExecTime.Values[2] {
+		t.Errorf("expect P95 and Median to be computed: %+v", stats.ExecTime)
+	}
+	if r.Overall.Stats().ExecTime.Percentiles[1] != 99.9 {
+		t.Errorf("expect overall percentiles but %v", r.Overall.Stats().ExecTime.Percentiles)
+	}
+}
+
+func TestSummarizer_Report_percentiles(t *testing.T) {
+	s := NewSummarizer()
+	analyzeFile(t, "./testdata/mysql-slow.timeseries.log", WithSummarizer(s))
+
+	if got := s.Report(WithPercentiles(Percentiles{99})).Overall.Stats().ExecTime.Percentiles; !cmp.Equal(got, Percentiles{99}) {
+		t.Errorf("expect the requested percentiles but %v", got)
+	}
+	if got := s.Report().Overall.Stats().ExecTime.Percentiles; !cmp.Equal(got, DefaultPercentiles) {
+		t.Errorf("expect a report not to change the percentiles of later ones but %v", got)
+	}
+}
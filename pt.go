@@ -0,0 +1,279 @@
+package querydigest
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// writePtQueryDigest renders the report in the layout of pt-query-digest's
+// default report (header, profile and per-query blocks), so that tools
+// scraping pt-query-digest output keep working.
+func writePtQueryDigest(w io.Writer, r *Report) error {
+	overall := r.Overall
+	if overall == nil {
+		overall = &SlowQuerySummary{}
+	}
+	span := r.Until.Sub(r.Since).Seconds()
+
+	fmt.Fprintln(w)
+	ptHeadline(w, fmt.Sprintf("# Overall: %s total, %s unique, %s QPS, %sx concurrency ",
+		ptShorten(float64(r.TotalQueryCount), 1000), ptShorten(float64(r.UniqueQueries), 1000),
+		ptShorten(ptRate(float64(r.TotalQueryCount), span), 1000), ptShorten(ptRate(r.TotalQueryTime, span), 1000)))
+	ptTimeRange(w, r.Since, r.Until)
+	fmt.Fprintf(w, "# %-16s %7s %7s %7s %7s %7s %7s %7s\n", "Attribute", "total", "min", "max", "avg", "95%", "stddev", "median")
+	fmt.Fprintf(w, "# %-16s %7s %7s %7s %7s %7s %7s %7s\n", "============", "=======", "=======", "=======", "=======", "=======", "=======", "=======")
+	if st := overall.Stats(); st != nil {
+		ptSecondsLine(w, fmt.Sprintf("# %-16s", "Exec time"), st.ExecTime)
+		ptSecondsLine(w, fmt.Sprintf("# %-16s", "Lock time"), st.LockTime)
+		ptCountLine(w, fmt.Sprintf("# %-16s", "Rows sent"), st.RowsSent)
+		ptCountLine(w, fmt.Sprintf("# %-16s", "Rows examine"), st.RowsExamine)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "# Profile")
+	fmt.Fprintln(w, "# Rank Query ID           Response time Calls R/Call V/M   Item")
+	fmt.Fprintln(w, "# ==== ================== ============= ===== ====== ===== ==============")
+	for i, s := range r.Summaries {
+		fmt.Fprintf(w, "# %4d %-18s %7.4f %4.1f%% %5d %6.4f %5.2f %s\n",
+			i+1, s.QueryID(), s.TotalTime, ptPercent(s.TotalTime, r.TotalQueryTime),
+			s.TotalQueryCount, s.TotalTime/float64(s.TotalQueryCount), ptVarianceToMean(s), ptItem(r.GroupBy, s))
+	}
+
+	for i, s := range r.Summaries {
+		writePtQuery(w, i+1, s, overall)
+	}
+	return nil
+}
+
+func writePtQuery(w io.Writer, rank int, s *SlowQuerySummary, overall *SlowQuerySummary) {
+	span := s.LastSeen.Sub(s.FirstSeen).Seconds()
+
+	fmt.Fprintln(w)
+	ptHeadline(w, fmt.Sprintf("# Query %d: %s QPS, %sx concurrency, ID %s at byte %d ",
+		rank, ptShorten(ptRate(float64(s.TotalQueryCount), span), 1000), ptShorten(ptRate(s.TotalTime, span), 1000),
+		s.QueryID(), s.SampleOffset))
+	fmt.Fprintf(w, "# Scores: V/M = %.2f\n", ptVarianceToMean(s))
+	ptTimeRange(w, s.FirstSeen, s.LastSeen)
+	fmt.Fprintf(w, "# %-12s %3s %7s %7s %7s %7s %7s %7s %7s\n", "Attribute", "pct", "total", "min", "max", "avg", "95%", "stddev", "median")
+	fmt.Fprintf(w, "# %-12s %3s %7s %7s %7s %7s %7s %7s %7s\n", "============", "===", "=======", "=======", "=======", "=======", "=======", "=======", "=======")
+	fmt.Fprintf(w, "# %-12s %3.0f %7s\n", "Count", ptPercent(float64(s.TotalQueryCount), float64(overall.TotalQueryCount)), ptShorten(float64(s.TotalQueryCount), 1000))
+	if st := s.Stats(); st != nil {
+		ptSecondsLine(w, ptPctPrefix("Exec time", s.TotalTime, overall.TotalTime), st.ExecTime)
+		ptSecondsLine(w, ptPctPrefix("Lock time", s.TotalLockTime, overall.TotalLockTime), st.LockTime)
+		ptCountLine(w, ptPctPrefix("Rows sent", float64(s.TotalRowsSent), float64(overall.TotalRowsSent)), st.RowsSent)
+		ptCountLine(w, ptPctPrefix("Rows examine", float64(s.TotalRowsExamined), float64(overall.TotalRowsExamined)), st.RowsExamine)
+	}
+
+	fmt.Fprintln(w, "# String:")
+	ptStringLine(w, "Databases", s.Databases, s.TotalQueryCount)
+	ptStringLine(w, "Hosts", s.Hosts, s.TotalQueryCount)
+	ptStringLine(w, "Users", s.Users, s.TotalQueryCount)
+
+	fmt.Fprintln(w, "# Query_time distribution")
+	hist := s.Histogram()
+	var max float64
+	for _, c := range hist.Counts {
+		max = math.Max(max, c)
+	}
+	labelWidth := 5
+	for i := range hist.Bounds {
+		if l := len(hist.Bounds.label(i)); l > labelWidth {
+			labelWidth = l
+		}
+	}
+	for i := range hist.Bounds {
+		label := fmt.Sprintf("%*s", labelWidth, strings.Replace(hist.Bounds.label(i), "~", "+", 1))
+		if i >= len(hist.Counts) || hist.Counts[i] <= 0 {
+			fmt.Fprintf(w, "# %s\n", label)
+			continue
+		}
+		fmt.Fprintf(w, "# %s  %s\n", label, strings.Repeat("#", int(math.Ceil(hist.Counts[i]/max*64))))
+	}
+
+	tables := ptTables(s.Fingerprint)
+	if len(tables) > 0 {
+		fmt.Fprintln(w, "# Tables")
+		for _, t := range tables {
+			fmt.Fprintf(w, "#    SHOW TABLE STATUS LIKE '%s'\\G\n", t)
+			fmt.Fprintf(w, "#    SHOW CREATE TABLE `%s`\\G\n", t)
+		}
+	}
+	sample := strings.TrimSuffix(strings.TrimSpace(s.RowSample), ";")
+	if strings.HasPrefix(strings.ToUpper(sample), "SELECT") {
+		fmt.Fprintln(w, "# EXPLAIN /*!50100 PARTITIONS*/")
+	}
+	fmt.Fprintf(w, "%s\\G\n", sample)
+}
+
+func ptHeadline(w io.Writer, line string) {
+	if n := 74 - len(line); n > 0 {
+		line += strings.Repeat("_", n)
+	}
+	fmt.Fprintln(w, line)
+}
+
+func ptTimeRange(w io.Writer, since, until time.Time) {
+	const layout = "2006-01-02T15:04:05"
+	switch {
+	case since.IsZero():
+	case since.Equal(until):
+		fmt.Fprintf(w, "# Time range: all events occurred at %s\n", since.Format(layout))
+	default:
+		fmt.Fprintf(w, "# Time range: %s to %s\n", since.Format(layout), until.Format(layout))
+	}
+}
+
+func ptSecondsLine(w io.Writer, prefix string, st SlowQueryStatSeconds) {
+	fmt.Fprintf(w, "%s %7s %7s %7s %7s %7s %7s %7s\n", prefix,
+		ptMicro(st.Total), ptMicro(st.Min), ptMicro(st.Max), ptMicro(st.Avg), ptMicro(st.P95), ptMicro(st.Stddev), ptMicro(st.Median))
+}
+
+func ptCountLine(w io.Writer, prefix string, st SlowQueryStatCount) {
+	fmt.Fprintf(w, "%s %7s %7s %7s %7s %7s %7s %7s\n", prefix,
+		ptShorten(float64(st.Total), 1000), ptShorten(float64(st.Min), 1000), ptShorten(float64(st.Max), 1000),
+		ptShorten(float64(st.Avg), 1000), ptShorten(float64(st.P95), 1000), ptShorten(float64(st.Stddev), 1000), ptShorten(float64(st.Median), 1000))
+}
+
+func ptStringLine(w io.Writer, name string, values map[string]int, total int) {
+	if len(values) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if values[keys[i]] != values[keys[j]] {
+			return values[keys[i]] > values[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	if len(keys) == 1 {
+		fmt.Fprintf(w, "# %-12s %s\n", name, keys[0])
+		return
+	}
+	var line string
+	for i, k := range keys {
+		item := fmt.Sprintf("%s (%d/%.0f%%)", k, values[k], ptPercent(float64(values[k]), float64(total)))
+		if i > 0 && len(line)+len(item) > 58 {
+			line += fmt.Sprintf("... %d more", len(keys)-i)
+			break
+		}
+		if i > 0 {
+			line += ", "
+		}
+		line += item
+	}
+	fmt.Fprintf(w, "# %-12s %s\n", name, line)
+}
+
+// ptMicro formats seconds like pt-query-digest's micro_t.
+func ptMicro(s Seconds) string {
+	t := float64(s)
+	switch {
+	case math.IsNaN(t) || math.IsInf(t, 0) || t <= 0:
+		return "0"
+	case t < 0.001:
+		return fmt.Sprintf("%.0fus", t*1000*1000)
+	case t < 1:
+		return fmt.Sprintf("%.0fms", t*1000)
+	default:
+		return fmt.Sprintf("%.0fs", t)
+	}
+}
+
+// ptShorten formats numbers like pt-query-digest's shorten, e.g. 1.23k.
+func ptShorten(n float64, divisor float64) string {
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return "0"
+	}
+	units := []string{"", "k", "M", "G", "T", "P", "E", "Z", "Y"}
+	var i int
+	for n >= divisor && i < len(units)-1 {
+		n /= divisor
+		i++
+	}
+	if i == 0 && n == math.Trunc(n) {
+		return fmt.Sprintf("%d", int64(n))
+	}
+	return fmt.Sprintf("%.2f%s", n, units[i])
+}
+
+func ptRate(n, seconds float64) float64 {
+	if seconds <= 0 {
+		return 0
+	}
+	return n / seconds
+}
+
+func ptPercent(n, total float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return n / total * 100
+}
+
+func ptPctPrefix(name string, n, total float64) string {
+	return fmt.Sprintf("# %-12s %3.0f", name, ptPercent(n, total))
+}
+
+func ptVarianceToMean(s *SlowQuerySummary) float64 {
+	st := s.Stats()
+	if st == nil {
+		return 0
+	}
+	stddev, avg := float64(st.ExecTime.Stddev), float64(st.ExecTime.Avg)
+	if math.IsNaN(stddev) || avg <= 0 {
+		return 0
+	}
+	return stddev * stddev / avg
+}
+
+func ptItem(groupBy GroupBy, s *SlowQuerySummary) string {
+	var parts []string
+	if s.Fingerprint != "" {
+		parts = append(parts, ptDistill(s.Fingerprint))
+	}
+	if len(s.Group) > 0 {
+		if label := groupBy.label(s.Group); label != "" {
+			parts = append(parts, label)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// ptDistill abbreviates a query to its statement type and tables,
+// like the Item column of pt-query-digest.
+func ptDistill(fingerprint string) string {
+	fields := strings.Fields(fingerprint)
+	if len(fields) == 0 {
+		return ""
+	}
+	parts := append([]string{strings.ToUpper(fields[0])}, ptTables(fingerprint)...)
+	return strings.Join(parts, " ")
+}
+
+func ptTables(fingerprint string) []string {
+	fields := strings.Fields(fingerprint)
+	var tables []string
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(fields); i++ {
+		switch strings.ToUpper(fields[i]) {
+		case "FROM", "JOIN", "INTO", "UPDATE", "TABLE":
+		default:
+			continue
+		}
+		t := strings.Trim(fields[i+1], "`\"(),;")
+		if t == "" || strings.EqualFold(t[:min(len(t), 6)], "select") || strings.EqualFold(t, "IF") || seen[t] {
+			continue
+		}
+		seen[t] = true
+		tables = append(tables, t)
+	}
+	return tables
+}
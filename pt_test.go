@@ -0,0 +1,82 @@
+package querydigest
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReport_Write_pt(t *testing.T) {
+	f, err := os.Open("./testdata/mysql-slow.use.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	report, err := Analyze(context.Background(), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := report.Write(&b, FormatPtQueryDigest); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+
+	for _, expect := range []string{
+		"# Overall: 2 total, 2 unique, ",
+		// the median is approximated within 1%
+		"# Exec time          327us   126us   201us   164us   201us    53us   127us\n",
+		"# Rank Query ID           Response time Calls R/Call V/M   Item\n",
+		"#    1 " + report.Summaries[0].QueryID() + "  0.0002 61.5%     1 0.0002  0.00 SELECT users\n",
+		"# Query 1: 0 QPS, 0x concurrency, ID " + report.Summaries[0].QueryID() + " at byte 410 ___",
+		"# Count         50       1\n",
+		"# Exec time     61   201us   201us   201us   201us   201us       0   201us\n",
+		"# Databases    isucari\n",
+		"# 100us  ################################################################\n",
+		"#    SHOW CREATE TABLE `users`\\G\n",
+		"SELECT * FROM users WHERE id = 2\\G\n",
+	} {
+		if !strings.Contains(out, expect) {
+			t.Errorf("output does not contain %q:\n%s", expect, out)
+		}
+	}
+}
+
+func Test_ptShorten(t *testing.T) {
+	cases := []struct {
+		n      float64
+		expect string
+	}{
+		{n: 0, expect: "0"},
+		{n: 12, expect: "12"},
+		{n: 0.48, expect: "0.48"},
+		{n: 1234, expect: "1.23k"},
+		{n: 5600000, expect: "5.60M"},
+	}
+	for _, c := range cases {
+		if got := ptShorten(c.n, 1000); got != c.expect {
+			t.Errorf("ptShorten(%f) = %s, expect %s", c.n, got, c.expect)
+		}
+	}
+}
+
+func Test_ptDistill(t *testing.T) {
+	cases := []struct {
+		fingerprint string
+		expect      string
+	}{
+		{fingerprint: "SELECT * FROM users WHERE id IN (SELECT user_id FROM orders)", expect: "SELECT users orders"},
+		{fingerprint: "select * from users where id in (select user_id from orders)", expect: "SELECT users orders"},
+		{fingerprint: "select * from (select id from items) as t", expect: "SELECT items"},
+		{fingerprint: "insert into `configs` (name) values (?+)", expect: "INSERT configs"},
+	}
+	for _, c := range cases {
+		if got := ptDistill(c.fingerprint); got != c.expect {
+			t.Errorf("ptDistill(%q) = %s, expect %s", c.fingerprint, got, c.expect)
+		}
+	}
+}
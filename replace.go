@@ -4,7 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"log"
+	"strings"
 	"sync"
 	"time"
 
@@ -28,57 +28,44 @@ var tokenizerPool = sync.Pool{
 }
 
 func ReplaceWithZeroValue(src []byte) (string, error) {
+	return Normalizer{}.Normalize(src)
+}
+
+// normalize is Normalize which also appends the names of the tables
+// referenced by the query to tables, unless it is nil.
+// When the parser does not normalize the query, err tells why and reason
+// classifies it, and normalized is the token by token fingerprint if the
+// query could be tokenized, or empty otherwise.
+func (n Normalizer) normalize(src []byte, tables *[]string) (normalized string, reason UnparsedReason, err error) {
+	if bytes.HasPrefix(src, adminCommandPrefix) {
+		return string(bytes.TrimSuffix(bytes.TrimSpace(src), []byte(";"))), "", nil
+	}
+
 	// FIXME evil work around
 	defer func() {
-		if err := recover(); err != nil {
-			// log.Printf("fatal err: %v", err)
-			log.Printf("fatal err")
-			return
+		if r := recover(); r != nil {
+			normalized, reason, err = "", UnparsedPanic, fmt.Errorf("parser panic: %v", r)
 		}
 	}()
-	tokenizer := tokenizerPool.Get().(*sqltoken.Tokenizer)
-	tokenizer.Line = 1
-	tokenizer.Col = 1
-	tokenizer.Scanner.Init(bytes.NewReader(src))
-	defer tokenizerPool.Put(tokenizer)
-
 	tokset := tokensPool.Get().([]*sqltoken.Token)
-	tokset = tokset[:0]
 	defer func() {
-		tokensPool.Put(tokset)
+		tokensPool.Put(tokset[:0])
 	}()
-
-	for {
-		var tok *sqltoken.Token
-		if len(tokset) < cap(tokset) {
-			tok = tokset[:len(tokset)+1][len(tokset)]
-		}
-		if tok == nil {
-			tok = &sqltoken.Token{}
-		}
-		t, err := tokenizer.Scan(tok)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return "", fmt.Errorf("tokenize failed src: %s : %w", string(src), err)
-		}
-		if t == nil {
-			continue
-		}
-		tokset = append(tokset, tok)
+	tokset, err = scanTokens(src, tokset[:0])
+	if err != nil {
+		return "", UnparsedTokenizerError, err
 	}
 
-	parser := xsqlparser.NewParserWithOptions()
-	parser.SetTokens(tokset)
-
-	stmt, err := parser.ParseStatement()
+	stmt, reason, err := parseStatement(tokset)
 	if err != nil {
-		log.Printf("Parse failed: invalied sql: %s \n", src[:50])
-		return "", err
+		// e.g. SHOW, CALL or CREATE TABLE with options the parser does not support
+		return n.tokenFingerprint(tokset, true), reason, err
 	}
 
 	res := sqlastutil.Apply(stmt, func(cursor *sqlastutil.Cursor) bool {
+		if tables != nil {
+			collectTable(tables, cursor.Node())
+		}
 		switch node := cursor.Node().(type) {
 		case *sqlast.LongValue:
 			cursor.Replace(sqlast.NewLongValue(0))
@@ -94,14 +81,295 @@ func ReplaceWithZeroValue(src []byte) (string, error) {
 			cursor.Replace(sqlast.NewTimeValue(time.Date(1970, 1, 1, 0, 0, 0, 0, nil)))
 		case *sqlast.DateTimeValue:
 			cursor.Replace(sqlast.NewDateTimeValue(time.Date(1970, 1, 1, 0, 0, 0, 0, nil)))
+		case *sqlast.UnaryExpr:
+			// negative numbers are a single placeholder like in pt-query-digest
+			if n.Placeholders && node.Op.Type == sqlast.Minus && isNumber(node.Expr) {
+				cursor.Replace(sqlast.NewIdent("?"))
+			}
+		case *sqlast.ConstructorSource:
+			// batch inserts share the fingerprint of a single row, whatever their size;
+			// truncated in place so that the other rows are not walked
+			node.Rows = node.Rows[:1]
+			if n.Placeholders {
+				node.Rows[0] = &sqlast.RowValueExpr{Values: []sqlast.Node{placeholderList}}
+			}
 		case *sqlast.InList:
-			cursor.Replace(&sqlast.InList{
+			l := &sqlast.InList{
 				Expr:    node.Expr,
 				Negated: node.Negated,
 				RParen:  node.RParen,
-			})
+			}
+			if n.Placeholders {
+				l.List = []sqlast.Node{placeholderList}
+			}
+			cursor.Replace(l)
+		case *sqlast.Table:
+			n.stripDatabase(node.Name)
+		case *sqlast.InsertStmt:
+			n.stripDatabase(node.TableName)
+		case *sqlast.UpdateStmt:
+			n.stripDatabase(node.TableName)
+		case *sqlast.DeleteStmt:
+			n.stripDatabase(node.TableName)
 		}
 		return true
 	}, nil)
-	return res.ToSQLString(), nil
+	normalized = res.ToSQLString()
+	if n.rewritesTokens() {
+		normalized = n.retokenize(normalized)
+	}
+	return normalized, "", nil
+}
+
+func isNumber(node sqlast.Node) bool {
+	switch node.(type) {
+	case *sqlast.LongValue, *sqlast.DoubleValue:
+		return true
+	}
+	return false
+}
+
+// scanTokens appends the tokens of src to tokset, skipping the whitespace.
+func scanTokens(src []byte, tokset []*sqltoken.Token) ([]*sqltoken.Token, error) {
+	tokenizer := tokenizerPool.Get().(*sqltoken.Tokenizer)
+	tokenizer.Line = 1
+	tokenizer.Col = 1
+	tokenizer.Scanner.Init(bytes.NewReader(src))
+	defer tokenizerPool.Put(tokenizer)
+
+	for {
+		var tok *sqltoken.Token
+		if len(tokset) < cap(tokset) {
+			tok = tokset[:len(tokset)+1][len(tokset)]
+		}
+		if tok == nil {
+			tok = &sqltoken.Token{}
+		}
+		t, err := tokenizer.Scan(tok)
+		if err == io.EOF {
+			return tokset, nil
+		}
+		if err != nil {
+			return tokset, err
+		}
+		if t == nil {
+			continue
+		}
+		tokset = append(tokset, tok)
+	}
+}
+
+// retokenize applies the token level options to the SQL printed by the parser,
+// which is returned as is if it cannot be tokenized.
+func (n Normalizer) retokenize(sql string) string {
+	tokset := tokensPool.Get().([]*sqltoken.Token)
+	defer func() {
+		tokensPool.Put(tokset[:0])
+	}()
+	tokset, err := scanTokens([]byte(sql), tokset[:0])
+	if err != nil {
+		return sql
+	}
+	// the keywords are kept as the parser printed them unless KeywordCase is set
+	return n.tokenFingerprint(tokset, n.KeywordCase != "")
+}
+
+// parseStatement parses the tokens, returning the panics of the parser on
+// unsupported syntax as errors.
+func parseStatement(tokens []*sqltoken.Token) (stmt sqlast.Stmt, reason UnparsedReason, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			stmt, reason, err = nil, UnparsedPanic, fmt.Errorf("parser panic: %v", r)
+		}
+	}()
+	parser := xsqlparser.NewParserWithOptions()
+	parser.SetTokens(tokens)
+	stmt, err = parser.ParseStatement()
+	if err != nil {
+		if !isParsedStatement(tokens) {
+			return nil, UnparsedUnsupported, err
+		}
+		return nil, UnparsedParserError, err
+	}
+	return stmt, "", nil
+}
+
+// parsedStatements are the keywords the parser starts the statements it supports with.
+var parsedStatements = map[string]bool{
+	"SELECT": true, "WITH": true, "INSERT": true, "UPDATE": true, "DELETE": true,
+	"CREATE": true, "ALTER": true, "DROP": true, "EXPLAIN": true,
+}
+
+func isParsedStatement(tokens []*sqltoken.Token) bool {
+	for _, tok := range tokens {
+		if tok.Kind == sqltoken.Whitespace || tok.Kind == sqltoken.Comment {
+			continue
+		}
+		word, ok := tok.Value.(*sqltoken.SQLWord)
+		return ok && parsedStatements[word.Keyword]
+	}
+	return false
+}
+
+// adminCommandPrefix starts the queries of the logged administrator commands,
+// e.g. `administrator command: Quit;`. The command itself is the fingerprint.
+var adminCommandPrefix = []byte("administrator command:")
+
+// tokenFingerprint normalizes a statement the parser cannot parse token by token:
+// literals are replaced with zero values like in ReplaceWithZeroValue, keywords
+// and the first word are upper-cased, the space between tokens is collapsed to a single space and
+// the trailing semicolon is dropped. The rows of VALUES are collapsed to the
+// first one like in ReplaceWithZeroValue, e.g. of REPLACE or INSERT IGNORE.
+// The token level options of n apply as well; the case of the keywords is
+// only normalized when normalizeCase is set.
+func (n Normalizer) tokenFingerprint(tokens []*sqltoken.Token, normalizeCase bool) string {
+	tokens = collapseRows(tokens, n.Placeholders)
+	if n.CollapseLimit {
+		tokens = collapseLimit(tokens)
+	}
+	var b strings.Builder
+	var prev *sqltoken.Token
+	for _, tok := range tokens {
+		if tok.Kind == sqltoken.Whitespace || tok.Kind == sqltoken.Comment || tok.Kind == sqltoken.Semicolon {
+			continue
+		}
+		first := prev == nil
+		if !first && sqltoken.ComparePos(prev.To, tok.From) != 0 {
+			b.WriteByte(' ')
+		}
+		prev = tok
+
+		switch tok.Kind {
+		case sqltoken.Number:
+			b.WriteString(n.literal("0"))
+		case sqltoken.SingleQuotedString, sqltoken.NationalStringLiteral:
+			b.WriteString(n.literal("''"))
+		case sqltoken.SQLKeyword:
+			w := tok.Value.(*sqltoken.SQLWord)
+			_, keyword := dialect.Keywords[w.Keyword]
+			keyword = keyword || (n.KeywordCase != "" && mysqlKeywords[w.Keyword])
+			switch {
+			case w.QuoteStyle == '`' && n.Unquote:
+				b.WriteString(w.Value)
+			case w.QuoteStyle != 0:
+				b.WriteString(w.String())
+			case n.Placeholders && (w.Keyword == "TRUE" || w.Keyword == "FALSE"):
+				b.WriteString("?")
+			case normalizeCase && (keyword || first):
+				// the statement type, e.g. SHOW, may not be a keyword of the dialect
+				b.WriteString(n.keyword(w.Keyword))
+			default:
+				b.WriteString(w.String())
+			}
+		default:
+			fmt.Fprint(&b, tok.Value)
+		}
+	}
+	return b.String()
+}
+
+func collectTable(tables *[]string, node sqlast.Node) {
+	var name *sqlast.ObjectName
+	switch n := node.(type) {
+	case *sqlast.Table:
+		name = n.Name
+	case *sqlast.InsertStmt:
+		name = n.TableName
+	case *sqlast.UpdateStmt:
+		name = n.TableName
+	case *sqlast.DeleteStmt:
+		name = n.TableName
+	}
+	if name == nil {
+		return
+	}
+
+	idents := make([]string, 0, len(name.Idents))
+	for _, i := range name.Idents {
+		idents = append(idents, strings.Trim(i.Value, "`\""))
+	}
+	table := strings.Join(idents, ".")
+	for _, t := range *tables {
+		if t == table {
+			return
+		}
+	}
+	*tables = append(*tables, table)
+}
+
+// collapseRows drops the rows following the first one of VALUES, and replaces
+// the first one with (?+) if placeholders is set.
+func collapseRows(tokens []*sqltoken.Token, placeholders bool) []*sqltoken.Token {
+	for i, tok := range tokens {
+		w, ok := tok.Value.(*sqltoken.SQLWord)
+		if !ok || w.QuoteStyle != 0 || (w.Keyword != "VALUES" && w.Keyword != "VALUE") {
+			continue
+		}
+		end := closingParen(tokens, i+1)
+		if end < 0 {
+			return tokens
+		}
+		next := end + 1
+		for next+1 < len(tokens) && tokens[next].Kind == sqltoken.Comma && tokens[next+1].Kind == sqltoken.LParen {
+			e := closingParen(tokens, next+1)
+			if e < 0 {
+				break
+			}
+			next = e + 1
+		}
+		if placeholders {
+			// a new slice, the tokens may be pooled
+			row := &sqltoken.Token{Kind: sqltoken.Char, Value: "?+", From: tokens[i+1].To, To: tokens[end].From}
+			out := append(tokens[:i+2:i+2], row, tokens[end])
+			return append(out, tokens[next:]...)
+		}
+		if next == end+1 {
+			return tokens
+		}
+		return append(tokens[:end+1:end+1], tokens[next:]...)
+	}
+	return tokens
+}
+
+// closingParen returns the index of the parenthesis closing the one at i, or -1.
+func closingParen(tokens []*sqltoken.Token, i int) int {
+	if i >= len(tokens) || tokens[i].Kind != sqltoken.LParen {
+		return -1
+	}
+	depth := 0
+	for j := i; j < len(tokens); j++ {
+		switch tokens[j].Kind {
+		case sqltoken.LParen:
+			depth++
+		case sqltoken.RParen:
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// collapseLimit drops the offset of the LIMIT clauses, e.g. of `LIMIT 20, 10` and `LIMIT 10 OFFSET 20`.
+func collapseLimit(tokens []*sqltoken.Token) []*sqltoken.Token {
+	out := tokens
+	copied := false
+	for i := 0; i+4 <= len(out); i++ {
+		w, ok := out[i].Value.(*sqltoken.SQLWord)
+		if !ok || w.QuoteStyle != 0 || w.Keyword != "LIMIT" || out[i+1].Kind != sqltoken.Number || out[i+3].Kind != sqltoken.Number {
+			continue
+		}
+		sep, ok := out[i+2].Value.(*sqltoken.SQLWord)
+		if out[i+2].Kind != sqltoken.Comma && !(ok && sep.QuoteStyle == 0 && sep.Keyword == "OFFSET") {
+			continue
+		}
+		if !copied {
+			// the tokens may be pooled
+			out = append([]*sqltoken.Token(nil), out...)
+			copied = true
+		}
+		out = append(out[:i+2], out[i+4:]...)
+	}
+	return out
 }
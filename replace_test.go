@@ -0,0 +1,72 @@
+package querydigest
+
+import "testing"
+
+func TestReplaceWithZeroValue_fallback(t *testing.T) {
+	cases := []struct {
+		src    string
+		expect string
+	}{
+		{src: "show databases;", expect: "SHOW databases"},
+		{src: "SHOW TABLE STATUS LIKE 'items';", expect: "SHOW TABLE STATUS LIKE ''"},
+		{src: "CALL refresh_ranking(10, 'daily');", expect: "CALL refresh_ranking(0, '')"},
+		{src: "SHOW /* monitoring */ FULL\n  PROCESSLIST ;", expect: "SHOW FULL PROCESSLIST"},
+		{src: "BEGIN;", expect: "BEGIN"},
+		{src: "administrator command: Quit;", expect: "administrator command: Quit"},
+		{src: "DROP TABLE IF EXISTS `shippings`;", expect: "DROP TABLE IF EXISTS `shippings`"},
+	}
+
+	for _, c := range cases {
+		got, err := ReplaceWithZeroValue([]byte(c.src))
+		if err != nil {
+			t.Errorf("%s: %v", c.src, err)
+			continue
+		}
+		if got != c.expect {
+			t.Errorf("%s: expect `%s` but `%s`", c.src, c.expect, got)
+		}
+	}
+}
+
+func TestReplaceWithZeroValue_insertRows(t *testing.T) {
+	cases := []struct {
+		srcs   []string
+		expect string
+	}{
+		{
+			srcs: []string{
+				"INSERT INTO items (id, name) VALUES (1, 'a');",
+				"INSERT INTO items (id, name) VALUES (1, 'a'), (2, 'b');",
+				"INSERT INTO items (id, name) VALUES (1, 'a'),(2, 'b'),(3, 'c');",
+			},
+			expect: "INSERT INTO items (id, name) VALUES (0, '')",
+		},
+		{
+			srcs: []string{
+				"INSERT INTO items (id, stock) VALUES (1, 10) ON DUPLICATE KEY UPDATE stock = stock + 10;",
+				"INSERT INTO items (id, stock) VALUES (1, 10), (2, 5) ON DUPLICATE KEY UPDATE stock = stock + 5;",
+			},
+			expect: "INSERT INTO items (id, stock) VALUES (0, 0) ON DUPLICATE KEY UPDATE stock = stock + 0",
+		},
+		{
+			srcs: []string{
+				"REPLACE INTO configs (name, val) VALUES ('a', 'x');",
+				"REPLACE INTO configs (name, val) VALUES ('a', 'x'), ('b', CONCAT('y', 'z'));",
+			},
+			expect: "REPLACE INTO configs (name, val) VALUES ('', '')",
+		},
+	}
+
+	for _, c := range cases {
+		for _, src := range c.srcs {
+			got, err := ReplaceWithZeroValue([]byte(src))
+			if err != nil {
+				t.Errorf("%s: %v", src, err)
+				continue
+			}
+			if got != c.expect {
+				t.Errorf("%s: expect `%s` but `%s`", src, c.expect, got)
+			}
+		}
+	}
+}
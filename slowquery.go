@@ -3,16 +3,15 @@ package querydigest
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"strconv"
 	"strings"
+	"time"
 	"unsafe"
 
 	"github.com/stuartcarnie/go-simd/unicode/utf8"
-
-	"github.com/akito0107/querydigest/internal/dart"
 )
 
 type SlowQueryScanner struct {
@@ -20,17 +19,49 @@ type SlowQueryScanner struct {
 	line         string
 	currentInfo  SlowQueryInfo
 	err          error
+	parseErrors  []*ParseError
 	queryBuf     *bytes.Buffer
-	queryTimeBuf *bytes.Buffer
+	hasQueryTime bool
+	hasUserHost  bool
+	headerErr    error
+
+	offset      int64
+	lineNum     int
+	lineOffset  int64
+	entryOffset int64
+	entryLine   int
+}
+
+// ParseError describes a malformed or unreadable part of a slow log.
+// Offset is the byte offset and Line the 1-based line number where the
+// offending entry starts.
+type ParseError struct {
+	// Source is the name of the log, set by AnalyzeSources.
+	Source string
+	Offset int64
+	Line   int
+	Err    error
 }
 
+func (e *ParseError) Error() string {
+	if e.Source != "" {
+		return fmt.Sprintf("%s: line %d (offset %d): %v", e.Source, e.Line, e.Offset, e.Err)
+	}
+	return fmt.Sprintf("line %d (offset %d): %v", e.Line, e.Offset, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+var errMissingQueryTime = errors.New("missing Query_time header")
+
 const ioBufSize = 128 * 1024 * 1024
 
 func NewSlowQueryScanner(r io.Reader) *SlowQueryScanner {
 	return &SlowQueryScanner{
-		reader:       bufio.NewReaderSize(r, ioBufSize),
-		queryBuf:     &bytes.Buffer{},
-		queryTimeBuf: &bytes.Buffer{},
+		reader:   bufio.NewReaderSize(r, ioBufSize),
+		queryBuf: &bytes.Buffer{},
 	}
 }
 
@@ -38,79 +69,308 @@ func (s *SlowQueryScanner) SlowQueryInfo() *SlowQueryInfo {
 	return &s.currentInfo
 }
 
+// Err returns the first fatal error that stopped the scan, as a *ParseError.
+// io.EOF is not reported.
 func (s *SlowQueryScanner) Err() error {
 	return s.err
 }
 
+// ParseErrors returns the entries skipped so far because their header was malformed.
+// Unlike Err, these do not stop the scan.
+func (s *SlowQueryScanner) ParseErrors() []*ParseError {
+	return s.parseErrors
+}
+
 func (s *SlowQueryScanner) Next() bool {
 	if s.err != nil {
 		return false
 	}
 	for {
-		for !strings.HasPrefix(s.line, "# Time:") {
-			if err := s.nextLine(); err == io.EOF {
-				return false
-			} else if err != nil {
-				s.err = err
+		for !isHeaderStart(s.line) {
+			if !s.advance() {
 				return false
 			}
 		}
 
-		if err := s.nextLine(); err != nil {
-			s.err = err
-			return false
-		}
-
-		if err := s.nextLine(); err != nil {
-			s.err = err
-			return false
-		}
-
-		s.queryTimeBuf.Reset()
-		s.queryTimeBuf.WriteString(s.line)
-
-		for {
-			if err := s.nextLine(); err == io.EOF {
-				return false
-			} else if err != nil {
-				s.err = err
+		s.resetHeader()
+		s.entryOffset, s.entryLine = s.lineOffset, s.lineNum
+		for strings.HasPrefix(s.line, "#") && !isAdminCommand(s.line) {
+			s.parseHeaderLine(s.line)
+			if !s.advance() {
 				return false
 			}
+		}
+		if !s.hasUserHost {
+			// unlike the database of the session, the user is not carried over
+			s.currentInfo.User, s.currentInfo.Host = "", ""
+		}
 
+		for !strings.HasPrefix(s.line, "#") || isAdminCommand(s.line) {
 			s.queryBuf.Reset()
 
-			for {
-				s.queryBuf.WriteString(s.line)
-				if strings.HasSuffix(s.line, ";") {
-					break
-				}
-				if err := s.nextLine(); err != nil {
-					s.err = err
-					return false
+			// a query without the trailing ';' ends at the next entry or at EOF
+			eof := false
+			if isAdminCommand(s.line) {
+				s.queryBuf.WriteString(s.line[len("# "):])
+			} else {
+				for {
+					if s.queryBuf.Len() > 0 {
+						s.queryBuf.WriteByte('\n')
+					}
+					s.queryBuf.WriteString(s.line)
+					if strings.HasSuffix(s.line, ";") {
+						break
+					}
+					if !s.advance() {
+						eof = true
+						break
+					}
+					if isHeaderStart(s.line) {
+						break
+					}
 				}
 			}
 
 			b := s.queryBuf.Bytes()
-			if len(b) > 6 && parsableQueryLine(b[:6]) {
+			if len(bytes.TrimSpace(b)) > 0 && !s.parseSessionStatement(unsafeString(b)) {
+				if err := s.headerError(); err != nil {
+					s.parseErrors = append(s.parseErrors, err)
+					break
+				}
 				if cap(s.currentInfo.RawQuery) < len(b) {
 					s.currentInfo.RawQuery = make([]byte, len(b))
 				}
 				s.currentInfo.RawQuery = s.currentInfo.RawQuery[:len(b)]
 				copy(s.currentInfo.RawQuery, b)
-				parseQueryTime(&s.currentInfo.QueryTime, unsafeString(s.queryTimeBuf.Bytes()))
+				s.currentInfo.Offset = s.entryOffset
+				if !isHeaderStart(s.line) {
+					s.line = ""
+				}
 				return true
-			} else if strings.HasPrefix(s.line, "#") {
+			}
+
+			if eof {
+				return false
+			}
+			if isHeaderStart(s.line) {
 				break
 			}
+			if !s.advance() {
+				return false
+			}
+		}
+	}
+}
+
+// advance reads the next line, reporting false on EOF or on a read error.
+func (s *SlowQueryScanner) advance() bool {
+	if err := s.nextLine(); err == io.EOF {
+		return false
+	} else if err != nil {
+		s.err = &ParseError{Offset: s.offset, Line: s.lineNum + 1, Err: err}
+		return false
+	}
+	return true
+}
+
+func (s *SlowQueryScanner) headerError() *ParseError {
+	err := s.headerErr
+	if err == nil && !s.hasQueryTime {
+		err = errMissingQueryTime
+	}
+	if err == nil {
+		return nil
+	}
+	return &ParseError{Offset: s.entryOffset, Line: s.entryLine, Err: err}
+}
+
+func isHeaderStart(line string) bool {
+	return strings.HasPrefix(line, "# Time:") || strings.HasPrefix(line, "# User@Host:")
+}
+
+// isAdminCommand reports whether the line logs a command of the client protocol
+// instead of a query, e.g. `# administrator command: Quit;`.
+func isAdminCommand(line string) bool {
+	return strings.HasPrefix(line, "# administrator command:")
+}
+
+func (s *SlowQueryScanner) resetHeader() {
+	s.currentInfo.QueryTime = QueryTime{}
+	s.currentInfo.Time = time.Time{}
+	s.currentInfo.ConnectionID = 0
+	for k := range s.currentInfo.Attributes {
+		delete(s.currentInfo.Attributes, k)
+	}
+	s.hasQueryTime = false
+	s.hasUserHost = false
+	s.headerErr = nil
+}
+
+func (s *SlowQueryScanner) parseHeaderLine(line string) {
+	switch {
+	case strings.HasPrefix(line, "# Time:"):
+		if t, err := parseLogTime(line[len("# Time:"):]); err == nil {
+			s.currentInfo.Time = t
+		}
+	case strings.HasPrefix(line, "# User@Host:"):
+		user, host, id := parseUserHost(line[len("# User@Host:"):])
+		s.currentInfo.User = internString(s.currentInfo.User, user)
+		s.currentInfo.Host = internString(s.currentInfo.Host, host)
+		s.currentInfo.ConnectionID = id
+		s.hasUserHost = true
+	default:
+		parseAttributes(line[1:], func(key, value string) {
+			if err := s.setAttribute(key, value); err != nil && s.headerErr == nil {
+				s.headerErr = err
+			}
+		})
+	}
+}
+
+func (s *SlowQueryScanner) setAttribute(key, value string) error {
+	info := &s.currentInfo
+	switch key {
+	case "Query_time":
+		s.hasQueryTime = true
+		return parseFloatAttribute(&info.QueryTime.QueryTime, key, value)
+	case "Lock_time":
+		return parseFloatAttribute(&info.QueryTime.LockTime, key, value)
+	case "Rows_sent":
+		return parseIntAttribute(&info.QueryTime.RowsSent, key, value)
+	case "Rows_examined":
+		return parseIntAttribute(&info.QueryTime.RowsExamined, key, value)
+	case "Schema":
+		info.Database = internString(info.Database, value)
+		return nil
+	case "Thread_id":
+		if info.ConnectionID == 0 {
+			id, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid Thread_id %q: %w", value, err)
+			}
+			info.ConnectionID = id
+		}
+	}
+	if info.Attributes == nil {
+		info.Attributes = make(map[string]string)
+	}
+	info.Attributes[internString("", key)] = internString("", value)
+	return nil
+}
+
+func parseFloatAttribute(dst *float64, key, value string) error {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	*dst = f
+	return nil
+}
+
+func parseIntAttribute(dst *int, key, value string) error {
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	*dst = int(i)
+	return nil
+}
+
+// parseAttributes calls fn for every `Key: value` pair of a slow log header
+// line, regardless of their order or the amount of whitespace between them.
+// Words which are not followed by a colon (e.g. Percona's
+// `No InnoDB statistics available for this query`) are ignored.
+func parseAttributes(str string, fn func(key, value string)) {
+	for {
+		str = strings.TrimLeft(str, " \t")
+		if str == "" {
+			return
+		}
+		end := strings.IndexAny(str, " \t")
+		if end < 0 {
+			end = len(str)
+		}
+		word := str[:end]
+		str = str[end:]
+		if len(word) < 2 || word[len(word)-1] != ':' {
+			continue
+		}
+
+		str = strings.TrimLeft(str, " \t")
+		end = strings.IndexAny(str, " \t")
+		if end < 0 {
+			end = len(str)
+		}
+		value := str[:end]
+		if strings.HasSuffix(value, ":") {
+			// key without a value; let the next iteration read it as a key
+			fn(word[:len(word)-1], "")
+			continue
+		}
+		str = str[end:]
+		fn(word[:len(word)-1], value)
+	}
+}
+
+// parseSessionStatement picks up the `use db;` and `SET timestamp=N;` lines
+// mysqld writes in front of the logged query, and reports whether stmt is one
+// of them. The SET may also restore insert_id and last_insert_id, e.g.
+// `SET last_insert_id=5,insert_id=6,timestamp=1579240749;`.
+func (s *SlowQueryScanner) parseSessionStatement(stmt string) bool {
+	stmt = strings.TrimSuffix(strings.TrimSpace(stmt), ";")
+	switch {
+	case len(stmt) > 4 && strings.EqualFold(stmt[:4], "use "):
+		db := strings.Trim(strings.TrimSpace(stmt[4:]), "`")
+		s.currentInfo.Database = internString(s.currentInfo.Database, db)
+		return true
+	case strings.HasPrefix(stmt, "SET "):
+		var timestamp string
+		for _, assign := range strings.Split(stmt[len("SET "):], ",") {
+			eq := strings.IndexByte(assign, '=')
+			if eq < 0 {
+				return false
+			}
+			switch strings.TrimSpace(assign[:eq]) {
+			case "timestamp":
+				timestamp = strings.TrimSpace(assign[eq+1:])
+			case "insert_id", "last_insert_id":
+			default:
+				return false
+			}
+		}
+		if timestamp == "" || !s.currentInfo.Time.IsZero() {
+			return true
 		}
+		if ts, err := strconv.ParseInt(timestamp, 10, 64); err == nil {
+			s.currentInfo.Time = time.Unix(ts, 0).UTC()
+		}
+		return true
 	}
+	return false
 }
 
 func (s *SlowQueryScanner) nextLine() error {
-	l, _, err := s.reader.ReadLine()
+	l, err := s.reader.ReadSlice('\n')
+	if err == io.EOF && len(l) > 0 {
+		// the last line has no trailing newline, EOF is returned by the next call.
+		err = nil
+	}
+	if err == bufio.ErrBufferFull {
+		return fmt.Errorf("line exceeds %d bytes: %w", ioBufSize, err)
+	}
 	if err != nil {
 		return err
 	}
+	s.lineOffset = s.offset
+	s.offset += int64(len(l))
+	s.lineNum++
+
+	if n := len(l); n > 0 && l[n-1] == '\n' {
+		l = l[:n-1]
+	}
+	if n := len(l); n > 0 && l[n-1] == '\r' {
+		l = l[:n-1]
+	}
 	if utf8.Valid(l) {
 		s.line = unsafeString(l)
 	} else {
@@ -124,17 +384,15 @@ func unsafeString(b []byte) string {
 	return *(*string)(unsafe.Pointer(&b))
 }
 
-var supportedSQLs = dart.Must(dart.Build([]string{
-	"SELECT",
-	"INSERT",
-	"UPDATE",
-	"DELETE",
-	"WITH",
-	"ALTER",
-}))
-
-func parsableQueryLine(b []byte) bool {
-	return supportedSQLs.Match(b)
+// internString returns a copy of str detached from the read buffer, reusing
+// prev when it already holds the same value.
+func internString(prev, str string) string {
+	if prev == str {
+		return prev
+	}
+	b := make([]byte, len(str))
+	copy(b, str)
+	return string(b)
 }
 
 type QueryTime struct {
@@ -145,77 +403,93 @@ type QueryTime struct {
 }
 
 type SlowQueryInfo struct {
-	ParsedQuery string
-	RawQuery    []byte
-	QueryTime   QueryTime
+	ParsedQuery  string
+	RawQuery     []byte
+	QueryTime    QueryTime
+	Time         time.Time
+	User         string
+	Host         string
+	ConnectionID uint64
+	Database     string
+	// Attributes holds the header values which have no dedicated field,
+	// e.g. Rows_affected, Bytes_sent or InnoDB_IO_r_ops of Percona Server and MariaDB.
+	Attributes map[string]string
+	// Offset is the byte offset of the entry in the slow log.
+	Offset int64
+	// Source is the name of the log the entry was read from, set by AnalyzeSources.
+	Source string
+	// Tables referenced by the query. Only filled when grouping by table.
+	Tables []string
 }
 
 func (i *SlowQueryInfo) clone() *SlowQueryInfo {
 	rawQuery := make([]byte, len(i.RawQuery))
 	copy(rawQuery, i.RawQuery)
+	var attrs map[string]string
+	if len(i.Attributes) > 0 {
+		attrs = make(map[string]string, len(i.Attributes))
+		for k, v := range i.Attributes {
+			attrs[k] = v
+		}
+	}
 	return &SlowQueryInfo{
-		RawQuery:  rawQuery,
-		QueryTime: i.QueryTime,
+		RawQuery:     rawQuery,
+		QueryTime:    i.QueryTime,
+		Time:         i.Time,
+		User:         i.User,
+		Host:         i.Host,
+		ConnectionID: i.ConnectionID,
+		Database:     i.Database,
+		Attributes:   attrs,
+		Offset:       i.Offset,
+		Source:       i.Source,
+		Tables:       append([]string(nil), i.Tables...),
 	}
 }
 
-func parseHeader(str string) (queryTime, lockTime, rowsSent, rowsExamined string) {
-	// skip `# Query_time: `
-	str = str[14:]
-
-	var i int
-	for i = 0; i < len(str); i++ {
-		if str[i] == ' ' {
-			break
-		}
+// parseLogTime accepts both the RFC3339 timestamps written by MySQL 5.7+ and
+// the legacy `yymmdd hh:mm:ss` form of MySQL 5.6 and MariaDB.
+func parseLogTime(str string) (time.Time, error) {
+	str = strings.TrimSpace(str)
+	if t, err := time.Parse(time.RFC3339Nano, str); err == nil {
+		return t, nil
 	}
-	queryTime = str[:i]
-	str = str[i+13:]
-	for i = 0; i < len(str); i++ {
-		if str[i] == ' ' {
-			break
-		}
-	}
-	lockTime = str[:i]
-	str = str[i+12:]
-	for i = 0; i < len(str); i++ {
-		if str[i] == ' ' {
-			break
-		}
-	}
-	rowsSent = str[:i]
-	rowsExamined = str[i+17:]
-
-	return queryTime, lockTime, rowsSent, rowsExamined
+	return time.ParseInLocation("060102 15:04:05", strings.Join(strings.Fields(str), " "), time.Local)
 }
 
-func parseQueryTime(q *QueryTime, str string) {
-
-	queryTime, lockTime, rowsSent, rowsExamined := parseHeader(str)
-
-	// queryTimes := strings.SplitN(str, ":", 5)
-	// Query_time
-	qt, err := strconv.ParseFloat(queryTime, 64)
-	if err != nil {
-		log.Fatal(err)
+// parseUserHost parses the part after `# User@Host:`, e.g.
+// `isucari[isucari] @ localhost [127.0.0.1]  Id:     3`.
+// The host falls back to the client IP when no hostname was resolved.
+func parseUserHost(str string) (user, host string, id uint64) {
+	at := strings.Index(str, "@")
+	if at < 0 {
+		return strings.TrimSpace(str), "", 0
 	}
-	// Lock_time
-	lt, err := strconv.ParseFloat(lockTime, 64)
-	if err != nil {
-		log.Fatal(err)
+	user = strings.TrimSpace(str[:at])
+	if i := strings.IndexByte(user, '['); i >= 0 {
+		user = user[:i]
 	}
-	// Rows_sent
-	rs, err := strconv.ParseInt(rowsSent, 10, 64)
-	if err != nil {
-		log.Fatal(err)
+
+	rest := str[at+1:]
+	var ip string
+	if i := strings.IndexByte(rest, '['); i >= 0 {
+		host = strings.TrimSpace(rest[:i])
+		rest = rest[i+1:]
+		if j := strings.IndexByte(rest, ']'); j >= 0 {
+			ip = rest[:j]
+			rest = rest[j+1:]
+		}
+	} else {
+		host = strings.TrimSpace(rest)
+		rest = ""
 	}
-	// Rows_examined
-	re, err := strconv.ParseInt(rowsExamined, 10, 64)
-	if err != nil {
-		log.Fatal(err)
+	if host == "" {
+		host = ip
 	}
-	q.QueryTime = qt
-	q.LockTime = lt
-	q.RowsSent = int(rs)
-	q.RowsExamined = int(re)
+
+	if i := strings.Index(rest, "Id:"); i >= 0 {
+		id, _ = strconv.ParseUint(strings.TrimSpace(rest[i+3:]), 10, 64)
+	}
+
+	return user, host, id
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -27,16 +28,88 @@ func TestSlowQueryScanner_Next(t *testing.T) {
 					RowsSent:     1,
 					RowsExamined: 0,
 				},
+				Time:         time.Date(2020, 1, 17, 5, 59, 9, 832280000, time.UTC),
+				User:         "isucari",
+				Host:         "localhost",
+				ConnectionID: 2,
+				Offset:       182,
+			},
+		},
+		{
+			name:         "percona",
+			fixturesPath: "percona",
+			expect: SlowQueryInfo{
+				RawQuery: []byte("UPDATE items SET status = 'sold' WHERE id = 10;"),
+				QueryTime: QueryTime{
+					QueryTime:    0.012964,
+					LockTime:     0.001197,
+					RowsSent:     0,
+					RowsExamined: 1,
+				},
+				Time:         time.Date(2020, 1, 17, 6, 6, 15, 236547000, time.UTC),
+				User:         "isucari",
+				Host:         "localhost",
+				ConnectionID: 8,
+				Database:     "isucari",
+				Attributes: map[string]string{
+					"Thread_id":             "8",
+					"QC_hit":                "No",
+					"Rows_affected":         "1",
+					"Bytes_sent":            "52",
+					"Tmp_tables":            "0",
+					"Tmp_disk_tables":       "0",
+					"Tmp_table_sizes":       "0",
+					"InnoDB_trx_id":         "1A2B",
+					"Full_scan":             "No",
+					"Full_join":             "No",
+					"Tmp_table":             "No",
+					"Tmp_table_on_disk":     "No",
+					"Filesort":              "No",
+					"Filesort_on_disk":      "No",
+					"Merge_passes":          "0",
+					"InnoDB_IO_r_ops":       "0",
+					"InnoDB_IO_r_bytes":     "0",
+					"InnoDB_IO_r_wait":      "0.000000",
+					"InnoDB_rec_lock_wait":  "0.000000",
+					"InnoDB_queue_wait":     "0.000000",
+					"InnoDB_pages_distinct": "3",
+				},
+				Offset: 210,
+			},
+		},
+		{
+			name:         "mariadb",
+			fixturesPath: "mariadb",
+			expect: SlowQueryInfo{
+				RawQuery: []byte("SELECT * FROM orders WHERE user_id = 3;"),
+				QueryTime: QueryTime{
+					QueryTime:    0.5,
+					LockTime:     0.0001,
+					RowsSent:     10,
+					RowsExamined: 1000,
+				},
+				Time:         time.Date(2020, 1, 17, 6, 6, 15, 0, time.Local),
+				User:         "app",
+				Host:         "localhost",
+				ConnectionID: 9,
+				Database:     "shop",
+				Attributes: map[string]string{
+					"Thread_id":     "9",
+					"QC_hit":        "No",
+					"Rows_affected": "0",
+					"Bytes_sent":    "1024",
+				},
+				Offset: 162,
 			},
 		},
 		{
 			name:         "insert",
 			fixturesPath: "insert",
 			expect: SlowQueryInfo{
-				RawQuery: bytes.NewBufferString("INSERT INTO categories (`id`,`parent_id`,`category_name`) VALUES" +
-					"(1,0,\"ソファー\")," +
-					"(2,1,\"一人掛けソファー\")," +
-					"(3,1,\"二人掛けソファー\")," +
+				RawQuery: bytes.NewBufferString("INSERT INTO categories (`id`,`parent_id`,`category_name`) VALUES\n" +
+					"(1,0,\"ソファー\"),\n" +
+					"(2,1,\"一人掛けソファー\"),\n" +
+					"(3,1,\"二人掛けソファー\"),\n" +
 					"(4,1,\"コーナーソファー\");").Bytes(),
 				QueryTime: QueryTime{
 					QueryTime:    0.012964,
@@ -44,6 +117,11 @@ func TestSlowQueryScanner_Next(t *testing.T) {
 					RowsSent:     0,
 					RowsExamined: 0,
 				},
+				Time:         time.Date(2020, 1, 17, 6, 6, 15, 236547000, time.UTC),
+				User:         "isucari",
+				Host:         "localhost",
+				ConnectionID: 3,
+				Offset:       216,
 			},
 		},
 	}
@@ -77,25 +155,263 @@ func TestSlowQueryScanner_Next(t *testing.T) {
 	}
 }
 
-func Test_parseHeader(t *testing.T) {
+func TestSlowQueryScanner_Next_metadata(t *testing.T) {
+	f, err := os.Open("./testdata/mysql-slow.use.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
 
-	src := `# Query_time: 0.004370  Lock_time: 0.001289 Rows_sent: 2  Rows_examined: 2`
+	scanner := NewSlowQueryScanner(f)
 
-	queryTime, lockTime, rowsSent, rowsExamined := parseHeader(src)
+	var infos []SlowQueryInfo
+	for scanner.Next() {
+		infos = append(infos, *scanner.SlowQueryInfo().clone())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
 
-	if queryTime != "0.004370" {
-		t.Errorf("expect: `%s` but `%s`", "0.004370", queryTime)
+	expect := []SlowQueryInfo{
+		{
+			RawQuery: []byte("SELECT * FROM items WHERE id = 1;"),
+			QueryTime: QueryTime{
+				QueryTime:    0.000126,
+				RowsSent:     1,
+				RowsExamined: 0,
+			},
+			Time:         time.Date(2020, 1, 17, 5, 59, 9, 0, time.Local),
+			User:         "isucari",
+			Host:         "10.0.0.5",
+			ConnectionID: 12,
+			Database:     "isucari",
+			Offset:       183,
+		},
+		{
+			RawQuery: []byte("SELECT * FROM users WHERE id = 2;"),
+			QueryTime: QueryTime{
+				QueryTime:    0.000201,
+				LockTime:     0.00005,
+				RowsSent:     1,
+				RowsExamined: 1,
+			},
+			Time:         time.Unix(1579240750, 0).UTC(),
+			User:         "isucari",
+			Host:         "10.0.0.5",
+			ConnectionID: 12,
+			Database:     "isucari",
+			Offset:       410,
+		},
 	}
-	if lockTime != "0.001289" {
-		t.Errorf("expect: `%s` but `%s`", "0.001289", lockTime)
+
+	if diff := cmp.Diff(infos, expect); diff != "" {
+		t.Errorf("diff: %s", diff)
+	}
+}
+
+func TestSlowQueryScanner_Next_withoutUserHost(t *testing.T) {
+	f, err := os.Open("./testdata/mysql-slow.nouser.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	scanner := NewSlowQueryScanner(f)
+
+	var infos []SlowQueryInfo
+	for scanner.Next() {
+		infos = append(infos, *scanner.SlowQueryInfo().clone())
 	}
-	if rowsSent != "2" {
-		t.Errorf("expect: `%s` but `%s`", "2", rowsSent)
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
 	}
-	if rowsExamined != "2" {
-		t.Errorf("expect: `%s` but `%s`", "2", rowsExamined)
+	if len(infos) != 2 {
+		t.Fatalf("expect 2 entries but %d", len(infos))
+	}
+
+	// the user and host are not inherited from the previous entry, the database of the session is
+	last := infos[1]
+	if last.User != "" || last.Host != "" || last.ConnectionID != 0 {
+		t.Errorf("expect no user, host and connection but %q, %q, %d", last.User, last.Host, last.ConnectionID)
+	}
+	if last.Database != "isucari" {
+		t.Errorf("expect the database isucari but %q", last.Database)
+	}
+}
+
+func TestSlowQueryScanner_Next_statements(t *testing.T) {
+	f, err := os.Open("./testdata/mysql-slow.statements.log")
+	if err != nil {
+		t.Fatal(err)
 	}
+	defer f.Close()
+
+	scanner := NewSlowQueryScanner(f)
+
+	var queries []string
+	var times []int64
+	for scanner.Next() {
+		info := scanner.SlowQueryInfo()
+		queries = append(queries, string(info.RawQuery))
+		times = append(times, info.Time.Unix())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"BEGIN;",
+		"REPLACE INTO configs (name, val) VALUES ('payment_service_url', 'http://localhost:5555');",
+		"CALL refresh_ranking(10, 'daily');",
+		"SHOW TABLE STATUS LIKE 'items';",
+		"SET NAMES utf8mb4;",
+		"administrator command: Quit;",
+		"COMMIT;",
+	}
+	if diff := cmp.Diff(queries, expect); diff != "" {
+		t.Errorf("diff: %s", diff)
+	}
+	if times[1] != 1579240750 {
+		t.Errorf("expect the time of the combined SET but %d", times[1])
+	}
+}
+
+func TestSlowQueryScanner_Next_unterminated(t *testing.T) {
+	f, err := os.Open("./testdata/mysql-slow.unterminated.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	scanner := NewSlowQueryScanner(f)
 
+	var queries []string
+	var total float64
+	for scanner.Next() {
+		info := scanner.SlowQueryInfo()
+		queries = append(queries, string(info.RawQuery))
+		total += info.QueryTime.QueryTime
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"SELECT * FROM items WHERE id = 1",
+		"SELECT * FROM users\nWHERE id = 2",
+		"SELECT * FROM orders WHERE id = 3;",
+		"SELECT * FROM shippings WHERE id = 4",
+	}
+	if diff := cmp.Diff(queries, expect); diff != "" {
+		t.Errorf("diff: %s", diff)
+	}
+	if total < 0.999 || total > 1.001 {
+		t.Errorf("expect the query time of all entries but %f", total)
+	}
+}
+
+func TestSlowQueryScanner_ParseErrors(t *testing.T) {
+	f, err := os.Open("./testdata/mysql-slow.malformed.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	scanner := NewSlowQueryScanner(f)
+
+	var queries []string
+	for scanner.Next() {
+		queries = append(queries, string(scanner.SlowQueryInfo().RawQuery))
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(queries, []string{"SELECT * FROM items;"}); diff != "" {
+		t.Errorf("diff: %s", diff)
+	}
+
+	errs := scanner.ParseErrors()
+	if len(errs) != 1 {
+		t.Fatalf("expect 1 parse error but %d", len(errs))
+	}
+	if errs[0].Line != 1 || errs[0].Offset != 0 {
+		t.Errorf("unexpected position: line %d offset %d", errs[0].Line, errs[0].Offset)
+	}
+}
+
+func Test_parseUserHost(t *testing.T) {
+	cases := []struct {
+		src  string
+		user string
+		host string
+		id   uint64
+	}{
+		{src: " isucari[isucari] @ localhost []  Id:     2", user: "isucari", host: "localhost", id: 2},
+		{src: " root[root] @ db1.example.com [10.0.0.1]  Id: 345", user: "root", host: "db1.example.com", id: 345},
+		{src: " app[app] @  [10.0.0.5]", user: "app", host: "10.0.0.5"},
+	}
+
+	for _, c := range cases {
+		user, host, id := parseUserHost(c.src)
+		if user != c.user || host != c.host || id != c.id {
+			t.Errorf("parseUserHost(%q) = (%q, %q, %d), expect (%q, %q, %d)", c.src, user, host, id, c.user, c.host, c.id)
+		}
+	}
+}
+
+func Test_parseAttributes(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    string
+		expect map[string]string
+	}{
+		{
+			name: "mysql",
+			src:  `# Query_time: 0.004370  Lock_time: 0.001289 Rows_sent: 2  Rows_examined: 2`,
+			expect: map[string]string{
+				"Query_time":    "0.004370",
+				"Lock_time":     "0.001289",
+				"Rows_sent":     "2",
+				"Rows_examined": "2",
+			},
+		},
+		{
+			name: "percona indented",
+			src:  "#   InnoDB_IO_r_ops: 0\tInnoDB_IO_r_bytes: 0  InnoDB_IO_r_wait: 0.000000",
+			expect: map[string]string{
+				"InnoDB_IO_r_ops":   "0",
+				"InnoDB_IO_r_bytes": "0",
+				"InnoDB_IO_r_wait":  "0.000000",
+			},
+		},
+		{
+			name: "empty value",
+			src:  `# Thread_id: 8  Schema:  QC_hit: No`,
+			expect: map[string]string{
+				"Thread_id": "8",
+				"Schema":    "",
+				"QC_hit":    "No",
+			},
+		},
+		{
+			name:   "free text",
+			src:    `# No InnoDB statistics available for this query`,
+			expect: map[string]string{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := map[string]string{}
+			parseAttributes(c.src[1:], func(key, value string) {
+				got[key] = value
+			})
+			if diff := cmp.Diff(got, c.expect); diff != "" {
+				t.Errorf("diff: %s", diff)
+			}
+		})
+	}
 }
 
 func BenchmarkSlowQueryScanner_SlowQueryInfo(b *testing.B) {
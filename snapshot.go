@@ -0,0 +1,224 @@
+package querydigest
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const snapshotMagic = "querydigest snapshot"
+
+// snapshotVersion is bumped on every incompatible change of the snapshot format.
+const snapshotVersion = 2
+
+type snapshotHeader struct {
+	Magic   string
+	Version int
+}
+
+type snapshotSummarizer struct {
+	GroupBy      GroupBy
+	SeriesBucket time.Duration
+	// HistogramBounds is nil for DecadeBounds, when the summarizer had no bounds set.
+	HistogramBounds HistogramBounds
+	TotalTime       float64
+	TotalCount      int
+	Since           time.Time
+	Until           time.Time
+	Overall         snapshotSummary
+	Summaries       map[string]snapshotSummary
+}
+
+type snapshotSummary struct {
+	Fingerprint       string
+	Group             []string
+	Checksum          uint64
+	RowSample         string
+	TotalTime         float64
+	TotalLockTime     float64
+	TotalQueryCount   int
+	TotalRowsSent     int
+	TotalRowsExamined int
+	QueryTimes        distribution
+	LockTimes         distribution
+	RowsSent          distribution
+	RowsExamined      distribution
+	QueryTimeCounts   []float64
+	FirstSeen         time.Time
+	LastSeen          time.Time
+	SampleOffset      int64
+	Users             map[string]int
+	Hosts             map[string]int
+	Databases         map[string]int
+	Series            map[int64]*distribution
+}
+
+func newSnapshotSummary(s *SlowQuerySummary) snapshotSummary {
+	return snapshotSummary{
+		Fingerprint:       s.Fingerprint,
+		Group:             s.Group,
+		Checksum:          s.Checksum,
+		RowSample:         s.RowSample,
+		TotalTime:         s.TotalTime,
+		TotalLockTime:     s.TotalLockTime,
+		TotalQueryCount:   s.TotalQueryCount,
+		TotalRowsSent:     s.TotalRowsSent,
+		TotalRowsExamined: s.TotalRowsExamined,
+		QueryTimes:        s.queryTimes,
+		LockTimes:         s.lockTimes,
+		RowsSent:          s.rowsSent,
+		RowsExamined:      s.rowsExamined,
+		QueryTimeCounts:   s.queryTimeCounts,
+		FirstSeen:         s.FirstSeen,
+		LastSeen:          s.LastSeen,
+		SampleOffset:      s.SampleOffset,
+		Users:             s.Users,
+		Hosts:             s.Hosts,
+		Databases:         s.Databases,
+		Series:            s.series,
+	}
+}
+
+func (s snapshotSummary) summary(seriesBucket time.Duration, bounds HistogramBounds) *SlowQuerySummary {
+	return &SlowQuerySummary{
+		Fingerprint:       s.Fingerprint,
+		Group:             s.Group,
+		Checksum:          s.Checksum,
+		RowSample:         s.RowSample,
+		TotalTime:         s.TotalTime,
+		TotalLockTime:     s.TotalLockTime,
+		TotalQueryCount:   s.TotalQueryCount,
+		TotalRowsSent:     s.TotalRowsSent,
+		TotalRowsExamined: s.TotalRowsExamined,
+		FirstSeen:         s.FirstSeen,
+		LastSeen:          s.LastSeen,
+		SampleOffset:      s.SampleOffset,
+		Users:             s.Users,
+		Hosts:             s.Hosts,
+		Databases:         s.Databases,
+		queryTimes:        s.QueryTimes,
+		lockTimes:         s.LockTimes,
+		rowsSent:          s.RowsSent,
+		rowsExamined:      s.RowsExamined,
+		queryTimeCounts:   s.QueryTimeCounts,
+		seriesBucket:      seriesBucket,
+		histogramBounds:   bounds,
+		series:            s.Series,
+	}
+}
+
+// WriteSnapshot saves the collected state to w, so that it can be restored by
+// ReadSnapshot and merged with the digests of other logs, e.g. of other hosts.
+func (s *Summarizer) WriteSnapshot(w io.Writer) error {
+	s.mu.Lock()
+	snap := &snapshotSummarizer{
+		GroupBy:         s.groupBy,
+		SeriesBucket:    s.seriesBucket,
+		HistogramBounds: s.histogramBounds,
+		TotalTime:       s.totalTime,
+		TotalCount:      s.totalCount,
+		Since:           s.since,
+		Until:           s.until,
+		Overall:         newSnapshotSummary(s.overall.snapshot()),
+		Summaries:       make(map[string]snapshotSummary, len(s.m)),
+	}
+	for key, v := range s.m {
+		snap.Summaries[key] = newSnapshotSummary(v.snapshot())
+	}
+	s.mu.Unlock()
+
+	zw := gzip.NewWriter(w)
+	enc := gob.NewEncoder(zw)
+	if err := enc.Encode(&snapshotHeader{Magic: snapshotMagic, Version: snapshotVersion}); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := enc.Encode(snap); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	return zw.Close()
+}
+
+// ReadSnapshot restores a Summarizer saved by WriteSnapshot.
+func ReadSnapshot(r io.Reader) (*Summarizer, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+	defer zr.Close()
+
+	dec := gob.NewDecoder(zr)
+	var header snapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+	if header.Magic != snapshotMagic {
+		return nil, errors.New("read snapshot: not a querydigest snapshot")
+	}
+	if header.Version != snapshotVersion {
+		return nil, fmt.Errorf("read snapshot: unsupported version %d, expect %d", header.Version, snapshotVersion)
+	}
+	var snap snapshotSummarizer
+	if err := dec.Decode(&snap); err != nil {
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+
+	s := NewGroupedSummarizer(snap.GroupBy)
+	s.seriesBucket = snap.SeriesBucket
+	s.SetHistogramBounds(snap.HistogramBounds)
+	s.totalTime = snap.TotalTime
+	s.totalCount = snap.TotalCount
+	s.since = snap.Since
+	s.until = snap.Until
+	s.overall = *snap.Overall.summary(snap.SeriesBucket, snap.HistogramBounds)
+	for key, v := range snap.Summaries {
+		s.m[key] = v.summary(snap.SeriesBucket, snap.HistogramBounds)
+	}
+	return s, nil
+}
+
+// Merge adds the state of o to s. Both must be grouped by the same dimensions,
+// track the time series with the same bucket size and count the histograms in
+// the same bins.
+func (s *Summarizer) Merge(o *Summarizer) error {
+	if s.groupBy.String() != o.groupBy.String() {
+		return fmt.Errorf("merge: grouped by %s and %s", s.groupBy, o.groupBy)
+	}
+	if s.seriesBucket != o.seriesBucket {
+		return fmt.Errorf("merge: time series buckets of %s and %s", s.seriesBucket, o.seriesBucket)
+	}
+	if !s.overall.bounds().equal(o.overall.bounds()) {
+		return errors.New("merge: different histogram bounds")
+	}
+
+	o.mu.Lock()
+	overall := o.overall.snapshot()
+	summaries := make(map[string]*SlowQuerySummary, len(o.m))
+	for key, v := range o.m {
+		summaries[key] = v.snapshot()
+	}
+	totalTime, totalCount, since, until := o.totalTime, o.totalCount, o.since, o.until
+	o.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, v := range summaries {
+		if prev, ok := s.m[key]; ok {
+			prev.merge(v)
+		} else {
+			s.m[key] = v
+		}
+	}
+	s.overall.merge(overall)
+	s.totalTime += totalTime
+	s.totalCount += totalCount
+	if !since.IsZero() && (s.since.IsZero() || since.Before(s.since)) {
+		s.since = since
+	}
+	if until.After(s.until) {
+		s.until = until
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package querydigest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"math"
+	"os"
+	"testing"
+	"time"
+)
+
+func summarizeFile(t *testing.T, name string, s *Summarizer) {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := Analyze(context.Background(), f, WithSummarizer(s), WithTimeSeries(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSummarizer_snapshot(t *testing.T) {
+	files := []string{"./testdata/mysql-slow.group.log", "./testdata/mysql-slow.timeseries.log"}
+
+	direct := NewSummarizer()
+	var merged *Summarizer
+	for _, name := range files {
+		summarizeFile(t, name, direct)
+
+		s := NewSummarizer()
+		summarizeFile(t, name, s)
+		var b bytes.Buffer
+		if err := s.WriteSnapshot(&b); err != nil {
+			t.Fatal(err)
+		}
+		restored, err := ReadSnapshot(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if merged == nil {
+			merged = restored
+			continue
+		}
+		if err := merged.Merge(restored); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expect, got := direct.Report(), merged.Report()
+	if got.TotalQueryCount != expect.TotalQueryCount || math.Abs(got.TotalQueryTime-expect.TotalQueryTime) > 1e-9 {
+		t.Errorf("expect %d queries %fs but %d queries %fs", expect.TotalQueryCount, expect.TotalQueryTime, got.TotalQueryCount, got.TotalQueryTime)
+	}
+	if !got.Since.Equal(expect.Since) || !got.Until.Equal(expect.Until) {
+		t.Errorf("expect %s - %s but %s - %s", expect.Since, expect.Until, got.Since, got.Until)
+	}
+	if len(got.Summaries) != len(expect.Summaries) {
+		t.Fatalf("expect %d summaries but %d", len(expect.Summaries), len(got.Summaries))
+	}
+	for i, e := range expect.Summaries {
+		g := got.Summaries[i]
+		if g.Checksum != e.Checksum || g.TotalQueryCount != e.TotalQueryCount || g.Stats().ExecTime.P95 != e.Stats().ExecTime.P95 {
+			t.Errorf("%d: expect %s count %d p95 %v but %s count %d p95 %v", i,
+				e.QueryID(), e.TotalQueryCount, e.Stats().ExecTime.P95, g.QueryID(), g.TotalQueryCount, g.Stats().ExecTime.P95)
+		}
+		if len(g.TimeSeries().Count) != len(e.TimeSeries().Count) {
+			t.Errorf("%d: time series must be restored", i)
+		}
+	}
+}
+
+func TestSummarizer_Merge_groupBy(t *testing.T) {
+	err := NewSummarizer().Merge(NewGroupedSummarizer(GroupBy{DimensionUser}))
+	if err == nil {
+		t.Error("expect error for different group by")
+	}
+}
+
+func TestReadSnapshot_version(t *testing.T) {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	if err := gob.NewEncoder(zw).Encode(&snapshotHeader{Magic: snapshotMagic, Version: snapshotVersion + 1}); err != nil {
+		t.Fatal(err)
+	}
+	zw.Close()
+
+	if _, err := ReadSnapshot(&b); err == nil {
+		t.Error("expect error for unsupported version")
+	}
+	if _, err := ReadSnapshot(bytes.NewReader([]byte("# Time: 2020-01-17T05:59:09Z\n"))); err == nil {
+		t.Error("expect error for non-snapshot")
+	}
+}
@@ -0,0 +1,104 @@
+package querydigest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+type SortKey string
+
+const (
+	SortByTotalTime    SortKey = "total"
+	SortByAvgTime      SortKey = "avg"
+	SortByMaxTime      SortKey = "max"
+	SortByP95Time      SortKey = "p95"
+	SortByLockTime     SortKey = "lock"
+	SortByCount        SortKey = "count"
+	SortByRowsExamined SortKey = "rows_examined"
+	SortByRowsSent     SortKey = "rows_sent"
+	// SortByRowsRatio sorts by rows examined per row sent.
+	SortByRowsRatio SortKey = "ratio"
+)
+
+var sortKeys = []SortKey{
+	SortByTotalTime,
+	SortByAvgTime,
+	SortByMaxTime,
+	SortByP95Time,
+	SortByLockTime,
+	SortByCount,
+	SortByRowsExamined,
+	SortByRowsSent,
+	SortByRowsRatio,
+}
+
+type SortOrder struct {
+	Key       SortKey
+	Ascending bool
+}
+
+// ParseSortOrder parses `key`, `key:asc` or `key:desc`. Descending is the default.
+func ParseSortOrder(s string) (SortOrder, error) {
+	key, dir := s, "desc"
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		key, dir = s[:i], s[i+1:]
+	}
+
+	var order SortOrder
+	for _, k := range sortKeys {
+		if string(k) == key {
+			order.Key = k
+		}
+	}
+	if order.Key == "" {
+		return SortOrder{}, fmt.Errorf("unknown sort key: %s", key)
+	}
+
+	switch dir {
+	case "asc":
+		order.Ascending = true
+	case "desc":
+	default:
+		return SortOrder{}, fmt.Errorf("unknown sort direction: %s", dir)
+	}
+	return order, nil
+}
+
+func (k SortKey) value(s *SlowQuerySummary) float64 {
+	switch k {
+	case SortByAvgTime:
+		return s.TotalTime / float64(s.TotalQueryCount)
+	case SortByMaxTime:
+		if st := s.Stats(); st != nil {
+			return float64(st.ExecTime.Max)
+		}
+	case SortByP95Time:
+		if st := s.Stats(); st != nil {
+			return float64(st.ExecTime.P95)
+		}
+	case SortByLockTime:
+		return s.TotalLockTime
+	case SortByCount:
+		return float64(s.TotalQueryCount)
+	case SortByRowsExamined:
+		return float64(s.TotalRowsExamined)
+	case SortByRowsSent:
+		return float64(s.TotalRowsSent)
+	case SortByRowsRatio:
+		return float64(s.TotalRowsExamined) / math.Max(float64(s.TotalRowsSent), 1)
+	default:
+		return s.TotalTime
+	}
+	return 0
+}
+
+func sortSummaries(qs []*SlowQuerySummary, order SortOrder) {
+	sort.SliceStable(qs, func(i, j int) bool {
+		if order.Ascending {
+			return order.Key.value(qs[i]) < order.Key.value(qs[j])
+		}
+		return order.Key.value(qs[i]) > order.Key.value(qs[j])
+	})
+}
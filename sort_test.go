@@ -0,0 +1,73 @@
+package querydigest
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseSortOrder(t *testing.T) {
+	cases := []struct {
+		src     string
+		expect  SortOrder
+		wantErr bool
+	}{
+		{src: "total", expect: SortOrder{Key: SortByTotalTime}},
+		{src: "count:asc", expect: SortOrder{Key: SortByCount, Ascending: true}},
+		{src: "rows_examined:desc", expect: SortOrder{Key: SortByRowsExamined}},
+		{src: "unknown", wantErr: true},
+		{src: "p95:up", wantErr: true},
+	}
+
+	for _, c := range cases {
+		order, err := ParseSortOrder(c.src)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: expect error", c.src)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.src, err)
+			continue
+		}
+		if order != c.expect {
+			t.Errorf("%s: expect %+v but %+v", c.src, c.expect, order)
+		}
+	}
+}
+
+func Test_sortSummaries(t *testing.T) {
+	newSummaries := func() []*SlowQuerySummary {
+		return []*SlowQuerySummary{
+			{Fingerprint: "a", TotalTime: 3, TotalQueryCount: 30, TotalRowsSent: 10, TotalRowsExamined: 100},
+			{Fingerprint: "b", TotalTime: 2, TotalQueryCount: 1, TotalRowsSent: 0, TotalRowsExamined: 50},
+			{Fingerprint: "c", TotalTime: 1, TotalQueryCount: 5, TotalRowsSent: 1000, TotalRowsExamined: 1000},
+		}
+	}
+
+	cases := []struct {
+		order  SortOrder
+		expect []string
+	}{
+		{order: SortOrder{Key: SortByTotalTime}, expect: []string{"a", "b", "c"}},
+		{order: SortOrder{Key: SortByTotalTime, Ascending: true}, expect: []string{"c", "b", "a"}},
+		{order: SortOrder{Key: SortByAvgTime}, expect: []string{"b", "c", "a"}},
+		{order: SortOrder{Key: SortByCount}, expect: []string{"a", "c", "b"}},
+		{order: SortOrder{Key: SortByRowsSent}, expect: []string{"c", "a", "b"}},
+		{order: SortOrder{Key: SortByRowsRatio}, expect: []string{"b", "a", "c"}},
+	}
+
+	for _, c := range cases {
+		qs := newSummaries()
+		sortSummaries(qs, c.order)
+
+		var got []string
+		for _, q := range qs {
+			got = append(got, q.Fingerprint)
+		}
+		if diff := cmp.Diff(got, c.expect); diff != "" {
+			t.Errorf("%+v: diff: %s", c.order, diff)
+		}
+	}
+}
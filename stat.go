@@ -4,46 +4,182 @@ import (
 	"fmt"
 	"math"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
-type Histogram []float64
+// HistogramBounds are the lower bounds of the bins of a Histogram in seconds,
+// in ascending order. The last bin has no upper bound; query times below the
+// first bound are not counted.
+type HistogramBounds []float64
 
-var divider = []float64{1, 10, 100, 1000, 10000, 100000, 1000000, math.Inf(0)}
-var dividerLabel = []string{
-	"  1us",
-	" 10us",
-	"100us",
-	"  1ms",
-	" 10ms",
-	"100ms",
-	"   1s",
-	" 10s~",
+// DecadeBounds are a bin per decade from 1us to 10s, like pt-query-digest.
+var DecadeBounds = HistogramBounds{1e-6, 1e-5, 1e-4, 1e-3, 1e-2, 1e-1, 1, 10}
+
+// LogLinearBounds are the bins of 1, 2 and 5 of each decade from 1us to 10s,
+// e.g. to tell a 20ms query from an 80ms one.
+var LogLinearBounds = logLinearBounds(1e-6, 10)
+
+func logLinearBounds(min, max float64) HistogramBounds {
+	var b HistogramBounds
+	for decade := min; decade < max; decade *= 10 {
+		for _, m := range []float64{1, 2, 5} {
+			b = append(b, roundBound(decade*m))
+		}
+	}
+	return append(b, max)
+}
+
+// roundBound strips the error of the floating point arithmetic, e.g. of 1e-6*5.
+func roundBound(v float64) float64 {
+	f, _ := strconv.ParseFloat(strconv.FormatFloat(v, 'g', 12, 64), 64)
+	return f
+}
+
+// ParseHistogramBounds parses "decade", "1-2-5" or a comma separated list of
+// durations, e.g. `10ms,20ms,50ms,100ms`.
+func ParseHistogramBounds(s string) (HistogramBounds, error) {
+	switch s {
+	case "decade":
+		return DecadeBounds, nil
+	case "1-2-5":
+		return LogLinearBounds, nil
+	}
+	var b HistogramBounds
+	for _, f := range strings.Split(s, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(f))
+		if err != nil {
+			return nil, fmt.Errorf("invalid histogram bound: %s", f)
+		}
+		if d <= 0 || (len(b) > 0 && d.Seconds() <= b[len(b)-1]) {
+			return nil, fmt.Errorf("histogram bounds must be positive and ascending: %s", s)
+		}
+		b = append(b, d.Seconds())
+	}
+	return b, nil
+}
+
+func (b HistogramBounds) equal(o HistogramBounds) bool {
+	if len(b) != len(o) {
+		return false
+	}
+	for i := range b {
+		if b[i] != o[i] {
+			return false
+		}
+	}
+	return true
 }
 
-const maxLength = 75
+// index returns the bin of v, or -1 if v is below the first bound.
+func (b HistogramBounds) index(v float64) int {
+	if len(b) == 0 || !(v >= b[0]) {
+		return -1
+	}
+	return sort.Search(len(b), func(i int) bool { return b[i] > v }) - 1
+}
+
+// label returns the lower bound of the i-th bin, e.g. 20ms, and ~ for the last one.
+func (b HistogramBounds) label(i int) string {
+	label := formatBound(b[i])
+	if i == len(b)-1 {
+		label += "~"
+	}
+	return label
+}
+
+func formatBound(sec float64) string {
+	unit, v := "s", sec
+	switch {
+	case sec < 1e-3:
+		unit, v = "us", sec*1e6
+	case sec < 1:
+		unit, v = "ms", sec*1e3
+	}
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64) + unit
+}
+
+// Histogram counts the query times per bin of Bounds.
+type Histogram struct {
+	Bounds HistogramBounds
+	Counts []float64
+}
+
+// defaultWidth is the width of the rendered histogram when the terminal width is unknown.
+const defaultWidth = 80
 
 func (h Histogram) String() string {
-	tmp := make([]float64, len(h))
-	copy(tmp, h)
+	return h.Render(defaultWidth)
+}
 
-	sort.Float64Slice(tmp).Sort()
-	max := tmp[len(h)-1]
-	unit := maxLength / max
+// Render draws a bar per bin with its count and share of the counted query
+// times, the bars sized to fit in width columns.
+func (h Histogram) Render(width int) string {
+	var total, max float64
+	for _, c := range h.Counts {
+		total += c
+		max = math.Max(max, c)
+	}
+	labels := make([]string, len(h.Bounds))
+	var labelWidth int
+	for i := range h.Bounds {
+		labels[i] = h.Bounds.label(i)
+		if len(labels[i]) > labelWidth {
+			labelWidth = len(labels[i])
+		}
+	}
+	countWidth := len(strconv.Itoa(int(max)))
+	// label, ": ", count, " ", "100.0%", " "
+	barWidth := width - labelWidth - 2 - countWidth - 1 - 6 - 1
+	if barWidth < 10 {
+		barWidth = 10
+	}
 
 	var b strings.Builder
-
-	for i := 0; i < len(divider); i++ {
-		if len(h) <= i {
-			fmt.Fprintf(&b, "%s:\t\n", dividerLabel[i])
-			continue
+	for i, label := range labels {
+		var count, pct float64
+		if i < len(h.Counts) {
+			count = h.Counts[i]
+		}
+		if total > 0 {
+			pct = count / total * 100
 		}
-		length := int(unit * h[i])
-		if length <= 0 {
-			length = 0
+		var length int
+		if max > 0 {
+			length = int(count / max * float64(barWidth))
 		}
-		fmt.Fprintf(&b, "%s:\t%s\n", dividerLabel[i], strings.Repeat("#", length))
+		line := fmt.Sprintf("%*s: %*d %5.1f%% %s", labelWidth, label, countWidth, int(count), pct, strings.Repeat("#", length))
+		fmt.Fprintln(&b, strings.TrimRight(line, " "))
 	}
 
 	return b.String()
 }
+
+type HistogramBucket struct {
+	Label string  `json:"label"`
+	Min   Seconds `json:"min"`
+	Max   Seconds `json:"max"`
+	Count int     `json:"count"`
+}
+
+// Buckets returns the bins of the histogram with their bounds in seconds.
+// The last bucket has no upper bound.
+func (h Histogram) Buckets() []HistogramBucket {
+	buckets := make([]HistogramBucket, 0, len(h.Bounds))
+	for i := range h.Bounds {
+		b := HistogramBucket{
+			Label: h.Bounds.label(i),
+			Min:   Seconds(h.Bounds[i]),
+			Max:   Seconds(math.Inf(1)),
+		}
+		if i+1 < len(h.Bounds) {
+			b.Max = Seconds(h.Bounds[i+1])
+		}
+		if i < len(h.Counts) {
+			b.Count = int(h.Counts[i])
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets
+}
@@ -0,0 +1,117 @@
+package querydigest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseHistogramBounds(t *testing.T) {
+	cases := []struct {
+		src     string
+		expect  HistogramBounds
+		wantErr bool
+	}{
+		{src: "decade", expect: DecadeBounds},
+		{src: "10ms, 20ms,50ms,1s", expect: HistogramBounds{0.01, 0.02, 0.05, 1}},
+		{src: "500us", expect: HistogramBounds{0.0005}},
+		{src: "20ms,10ms", wantErr: true},
+		{src: "0s,10ms", wantErr: true},
+		{src: "10", wantErr: true},
+	}
+
+	for _, c := range cases {
+		b, err := ParseHistogramBounds(c.src)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: expect error", c.src)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.src, err)
+			continue
+		}
+		if diff := cmp.Diff(b, c.expect); diff != "" {
+			t.Errorf("%s: diff: %s", c.src, diff)
+		}
+	}
+
+	b, _ := ParseHistogramBounds("1-2-5")
+	var labels []string
+	for i := range b {
+		labels = append(labels, b.label(i))
+	}
+	if got := strings.Join(labels, " "); got != "1us 2us 5us 10us 20us 50us 100us 200us 500us 1ms 2ms 5ms 10ms 20ms 50ms 100ms 200ms 500ms 1s 2s 5s 10s~" {
+		t.Errorf("unexpected labels: %s", got)
+	}
+}
+
+func TestHistogramBounds_index(t *testing.T) {
+	cases := []struct {
+		v      float64
+		expect int
+	}{
+		{v: 0, expect: -1},
+		{v: 0.0000005, expect: -1},
+		{v: 0.000001, expect: 0},
+		{v: 0.019, expect: 12},
+		{v: 0.02, expect: 13},
+		{v: 0.08, expect: 14},
+		{v: 100, expect: 21},
+	}
+	for _, c := range cases {
+		if got := LogLinearBounds.index(c.v); got != c.expect {
+			t.Errorf("%v: expect %d but %d", c.v, c.expect, got)
+		}
+	}
+}
+
+func TestHistogram_Render(t *testing.T) {
+	h := Histogram{Bounds: HistogramBounds{0.01, 0.1, 1}, Counts: []float64{1, 3, 0}}
+
+	expect := "" +
+		" 10ms: 1  25.0% ##########\n" +
+		"100ms: 3  75.0% ##############################\n" +
+		"  1s~: 0   0.0%\n"
+	if diff := cmp.Diff(h.Render(46), expect); diff != "" {
+		t.Errorf("diff: %s", diff)
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(h.Render(120)), "\n") {
+		if len(line) > 120 {
+			t.Errorf("line exceeds the width: %q", line)
+		}
+	}
+}
+
+func TestAnalyze_histogramBounds(t *testing.T) {
+	r := analyzeFile(t, "./testdata/mysql-slow.timeseries.log", WithHistogramBounds(LogLinearBounds))
+
+	var counts []int
+	for _, b := range r.Summaries[0].Histogram().Buckets() {
+		if b.Count > 0 {
+			counts = append(counts, b.Count)
+		}
+	}
+	if diff := cmp.Diff(counts, []int{2, 1, 1}); diff != "" {
+		t.Errorf("diff: %s", diff)
+	}
+
+	var b strings.Builder
+	if err := r.WriteWidth(&b, FormatText, 40); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(b.String(), "\n") {
+		if strings.Contains(line, "#") && len(line) > 40 {
+			t.Errorf("histogram line exceeds the width: %q", line)
+		}
+	}
+
+	s := NewSummarizer()
+	s.SetHistogramBounds(LogLinearBounds)
+	if err := s.Merge(NewSummarizer()); err == nil {
+		t.Error("expect error merging different histogram bounds")
+	}
+}
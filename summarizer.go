@@ -1,53 +1,190 @@
 package querydigest
 
 import (
+	"hash/fnv"
 	"sort"
 	"sync"
+	"time"
 )
 
 type Summarizer struct {
-	m         map[string]*SlowQuerySummary
-	mu        sync.Mutex
-	totalTime float64
+	groupBy    GroupBy
+	m          map[string]*SlowQuerySummary
+	overall    SlowQuerySummary
+	mu         sync.Mutex
+	totalTime  float64
+	totalCount int
+	since      time.Time
+	until      time.Time
+	// seriesBucket is the bucket size of the time series of the summaries, if tracked.
+	seriesBucket time.Duration
+	// histogramBounds are the bins of the Query_time histograms, DecadeBounds if nil.
+	histogramBounds HistogramBounds
+	// percentiles are computed in the stats of the summaries, DefaultPercentiles if nil.
+	percentiles Percentiles
 }
 
 func NewSummarizer() *Summarizer {
+	return NewGroupedSummarizer(defaultGroupBy)
+}
+
+// NewGroupedSummarizer returns a Summarizer which aggregates the events by
+// the given dimensions instead of the normalized query only.
+func NewGroupedSummarizer(groupBy GroupBy) *Summarizer {
 	return &Summarizer{
-		m: make(map[string]*SlowQuerySummary),
+		groupBy: groupBy,
+		m:       make(map[string]*SlowQuerySummary),
 	}
 }
 
+// TrackTimeSeries makes the summaries keep their query times per bucket of
+// the given size for ComputeTimeSeries. It must be called before Collect.
+func (s *Summarizer) TrackTimeSeries(bucket time.Duration) {
+	s.seriesBucket = bucket
+}
+
+// SetPercentiles sets the percentiles computed by Summarize and Overall.
+func (s *Summarizer) SetPercentiles(ps Percentiles) {
+	s.mu.Lock()
+	s.percentiles = ps
+	s.mu.Unlock()
+}
+
+// SetHistogramBounds sets the bins the query times of the summaries are
+// counted in for their histograms. It must be called before Collect.
+func (s *Summarizer) SetHistogramBounds(b HistogramBounds) {
+	s.histogramBounds = b
+	s.overall.histogramBounds = b
+}
+
+func (s *Summarizer) GroupBy() GroupBy {
+	return s.groupBy
+}
+
+// Map returns the summaries by group key. It must not be used while events are collected.
 func (s *Summarizer) Map() map[string]*SlowQuerySummary {
 	return s.m
 }
 
 func (s *Summarizer) TotalQueryTime() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.totalTime
 }
 
+func (s *Summarizer) TotalQueryCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.totalCount
+}
+
+// TimeRange returns the timestamps of the oldest and the newest collected events.
+func (s *Summarizer) TimeRange() (since, until time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.since, s.until
+}
+
+// Collect adds the event to the summary of its group. When grouped by table,
+// an event referencing several tables is added to each of their summaries,
+// while it is counted once in the totals.
 func (s *Summarizer) Collect(i *SlowQueryInfo) {
 	s.mu.Lock()
-	summary, ok := s.m[i.ParsedQuery]
-	if !ok {
-		summary = &SlowQuerySummary{
-			RowSample: string(i.RawQuery),
+	for _, group := range s.groupBy.groups(i) {
+		key := groupKey(group)
+		summary, ok := s.m[key]
+		if !ok {
+			summary = &SlowQuerySummary{
+				Checksum:        fingerprintChecksum(key),
+				RowSample:       string(i.RawQuery),
+				SampleOffset:    i.Offset,
+				seriesBucket:    s.seriesBucket,
+				histogramBounds: s.histogramBounds,
+			}
+			if s.groupBy.has(DimensionFingerprint) {
+				summary.Fingerprint = i.ParsedQuery
+			}
+			if !s.groupBy.isFingerprint() {
+				summary.Group = group
+			}
+			s.m[key] = summary
 		}
+		summary.appendQueryTime(i)
 	}
-	summary.appendQueryTime(i)
-	s.m[i.ParsedQuery] = summary
+	s.overall.appendQueryTime(i)
 	s.totalTime += i.QueryTime.QueryTime
+	s.totalCount++
+	if !i.Time.IsZero() {
+		if s.since.IsZero() || i.Time.Before(s.since) {
+			s.since = i.Time
+		}
+		if i.Time.After(s.until) {
+			s.until = i.Time
+		}
+	}
 	s.mu.Unlock()
 }
 
+// fingerprintChecksum returns the 64-bit FNV-1a hash of the fingerprint or group key.
+func fingerprintChecksum(fingerprint string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(fingerprint))
+	return h.Sum64()
+}
+
+// Overall returns a summary of every collected event.
+func (s *Summarizer) Overall() *SlowQuerySummary {
+	return s.overallWithPercentiles(nil)
+}
+
+// overallWithPercentiles is Overall computing ps instead of the percentiles of s, unless nil.
+func (s *Summarizer) overallWithPercentiles(ps Percentiles) *SlowQuerySummary {
+	s.mu.Lock()
+	o := s.overall.snapshot()
+	if ps == nil {
+		ps = s.percentiles
+	}
+	s.mu.Unlock()
+
+	o.ComputeHistogram()
+	o.ComputeStatsWithPercentiles(ps)
+	return o
+}
+
+// Report returns the digest of the collected events, e.g. of merged snapshots.
+// Of the options, only WithSortKey, WithSortOrder, WithLimit and WithPercentiles apply.
+func (s *Summarizer) Report(opts ...Option) *Report {
+	a := &analyzer{opts: newOptions(opts), summarizer: s}
+	return a.report(nil)
+}
+
+// Summarize returns the summaries sorted by total time. They are copies,
+// so it may be called while events are still being collected.
 func (s *Summarizer) Summarize() []*SlowQuerySummary {
+	return s.summarizeWithPercentiles(nil)
+}
+
+// summarizeWithPercentiles is Summarize computing ps instead of the percentiles of s, unless nil.
+func (s *Summarizer) summarizeWithPercentiles(ps Percentiles) []*SlowQuerySummary {
+	s.mu.Lock()
 	qs := make([]*SlowQuerySummary, 0, len(s.m))
 	for _, v := range s.m {
+		qs = append(qs, v.snapshot())
+	}
+	if ps == nil {
+		ps = s.percentiles
+	}
+	s.mu.Unlock()
+
+	for _, v := range qs {
 		v.ComputeHistogram()
-		v.ComputeStats()
-		qs = append(qs, v)
+		v.ComputeStatsWithPercentiles(ps)
 	}
 
 	sort.Slice(qs, func(i, j int) bool {
+		if qs[i].TotalTime == qs[j].TotalTime {
+			return qs[i].Checksum < qs[j].Checksum
+		}
 		return qs[i].TotalTime > qs[j].TotalTime
 	})
 
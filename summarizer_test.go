@@ -0,0 +1,28 @@
+package querydigest
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestSummarizer_Collect_checksum(t *testing.T) {
+	summarizer := NewSummarizer()
+	for _, q := range []string{"SELECT * FROM a WHERE id = 0", "SELECT * FROM b WHERE id = 0", "SELECT * FROM a WHERE id = 0"} {
+		summarizer.Collect(&SlowQueryInfo{ParsedQuery: q, RawQuery: []byte(q)})
+	}
+
+	m := summarizer.Map()
+	if len(m) != 2 {
+		t.Fatalf("expect 2 summaries but %d", len(m))
+	}
+	a, b := m["SELECT * FROM a WHERE id = 0"], m["SELECT * FROM b WHERE id = 0"]
+	if a.Checksum != fingerprintChecksum("SELECT * FROM a WHERE id = 0") {
+		t.Errorf("checksum must be derived from the fingerprint")
+	}
+	if a.Checksum == b.Checksum {
+		t.Errorf("different fingerprints must have different checksums")
+	}
+	if !regexp.MustCompile(`^0x[0-9A-F]{16}$`).MatchString(a.QueryID()) {
+		t.Errorf("unexpected query id format: %s", a.QueryID())
+	}
+}
@@ -1,28 +1,60 @@
 package querydigest
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"math"
-	"sort"
 	"strings"
+	"time"
 
 	"github.com/jedib0t/go-pretty/table"
-	"gonum.org/v1/gonum/stat"
 )
 
 type SlowQuerySummary struct {
-	RowSample          string
-	TotalTime          float64
-	TotalLockTime      float64
-	TotalQueryCount    int
-	TotalRowsSent      int
-	TotalRowsExamined  int
-	QueryTimes         []QueryTime
-	stats              *slowQueryStats
+	// Fingerprint is the normalized query the events are grouped by.
+	Fingerprint string
+	// Group holds the value of each group-by dimension, unless grouped by fingerprint only.
+	Group []string
+	// Checksum is a hash of the group which stays the same across runs.
+	Checksum          uint64
+	RowSample         string
+	TotalTime         float64
+	TotalLockTime     float64
+	TotalQueryCount   int
+	TotalRowsSent     int
+	TotalRowsExamined int
+	FirstSeen         time.Time
+	LastSeen          time.Time
+	// SampleOffset is the byte offset of RowSample in the slow log.
+	SampleOffset int64
+	// Users, Hosts and Databases count the events per value.
+	Users              map[string]int
+	Hosts              map[string]int
+	Databases          map[string]int
+	stats              *SlowQueryStats
 	queryTimeHistogram Histogram
+	// The distributions of the values of the events replace the values
+	// themselves, so that the memory does not grow with the number of events.
+	queryTimes   distribution
+	lockTimes    distribution
+	rowsSent     distribution
+	rowsExamined distribution
+	// queryTimeCounts counts the query times per bin of histogramBounds, DecadeBounds if nil.
+	histogramBounds HistogramBounds
+	queryTimeCounts []float64
+	// series holds the query times by the UnixNano of their bucket, see ComputeTimeSeries.
+	seriesBucket time.Duration
+	series       map[int64]*distribution
+	timeSeries   *TimeSeries
 }
 
 func (s *SlowQuerySummary) String() string {
+	return s.format(defaultWidth)
+}
+
+// format renders the summary with the histogram sized to fit in width columns.
+func (s *SlowQuerySummary) format(width int) string {
 	var b strings.Builder
 
 	fmt.Fprintf(&b, "Summary:\n")
@@ -31,48 +63,59 @@ func (s *SlowQuerySummary) String() string {
 
 	fmt.Fprintf(&b, "%s\n", s.stats)
 
-	fmt.Fprintf(&b, "Query_time distribution:\n%v\n", s.queryTimeHistogram)
+	fmt.Fprintf(&b, "Query_time distribution:\n%s\n", s.queryTimeHistogram.Render(width))
 
 	fmt.Fprintf(&b, "QueryExample:\n%s\n", s.RowSample)
 
 	return b.String()
 }
 
+// QueryID returns Checksum in the hex form used by pt-query-digest, e.g. 0x3F79759E7FA2F117.
+func (s *SlowQuerySummary) QueryID() string {
+	return fmt.Sprintf("0x%016X", s.Checksum)
+}
+
+// Stats returns the statistics computed by ComputeStats.
+func (s *SlowQuerySummary) Stats() *SlowQueryStats {
+	return s.stats
+}
+
+// Histogram returns the Query_time distribution computed by ComputeHistogram.
+func (s *SlowQuerySummary) Histogram() Histogram {
+	return s.queryTimeHistogram
+}
+
+// ComputeStats computes the statistics with DefaultPercentiles.
 func (s *SlowQuerySummary) ComputeStats() {
-	queryTimes := make([]float64, 0, len(s.QueryTimes))
-	lockTimes := make([]float64, 0, len(s.QueryTimes))
-	rowsSents := make([]float64, 0, len(s.QueryTimes))
-	rowsExamines := make([]float64, 0, len(s.QueryTimes))
+	s.ComputeStatsWithPercentiles(DefaultPercentiles)
+}
 
-	for _, r := range s.QueryTimes {
-		queryTimes = append(queryTimes, r.QueryTime)
-		lockTimes = append(lockTimes, r.LockTime)
-		rowsSents = append(rowsSents, float64(r.RowsSent))
-		rowsExamines = append(rowsExamines, float64(r.RowsExamined))
+// ComputeStatsWithPercentiles computes the statistics with the given percentiles
+// in addition to P95 and Median, which are always computed.
+func (s *SlowQuerySummary) ComputeStatsWithPercentiles(ps Percentiles) {
+	if ps == nil {
+		ps = DefaultPercentiles
 	}
-
-	s.stats = &slowQueryStats{
-		ExecTime:    computeStatSeconds("Exec Time", queryTimes, s.TotalTime),
-		LockTime:    computeStatSeconds("Lock Time", lockTimes, s.TotalLockTime),
-		RowsSent:    computeStatCount("Rows Sent", rowsSents, float64(s.TotalRowsSent)),
-		RowsExamine: computeStatCount("Rows Examine", rowsExamines, float64(s.TotalRowsExamined)),
+	s.stats = &SlowQueryStats{
+		ExecTime:    computeStatSeconds("Exec Time", &s.queryTimes, s.TotalTime, ps),
+		LockTime:    computeStatSeconds("Lock Time", &s.lockTimes, s.TotalLockTime, ps),
+		RowsSent:    computeStatCount("Rows Sent", &s.rowsSent, float64(s.TotalRowsSent), ps),
+		RowsExamine: computeStatCount("Rows Examine", &s.rowsExamined, float64(s.TotalRowsExamined), ps),
 	}
 }
 
 func (s *SlowQuerySummary) ComputeHistogram() {
-	src := make([]float64, 0, len(s.QueryTimes))
-	for _, r := range s.QueryTimes {
-		qus := r.QueryTime * 1000 * 1000
-		if qus > 1 {
-			src = append(src, qus)
-		}
-	}
-
-	sort.Float64Slice(src).Sort()
-
-	hist := stat.Histogram(nil, divider, src, nil)
+	bounds := s.bounds()
+	counts := make([]float64, len(bounds))
+	copy(counts, s.queryTimeCounts)
+	s.queryTimeHistogram = Histogram{Bounds: bounds, Counts: counts}
+}
 
-	s.queryTimeHistogram = Histogram(hist)
+func (s *SlowQuerySummary) bounds() HistogramBounds {
+	if s.histogramBounds == nil {
+		return DecadeBounds
+	}
+	return s.histogramBounds
 }
 
 func (s *SlowQuerySummary) appendQueryTime(info *SlowQueryInfo) {
@@ -80,97 +123,201 @@ func (s *SlowQuerySummary) appendQueryTime(info *SlowQueryInfo) {
 	s.TotalTime += info.QueryTime.QueryTime
 	s.TotalRowsSent += info.QueryTime.RowsSent
 	s.TotalRowsExamined += info.QueryTime.RowsExamined
-	s.QueryTimes = append(s.QueryTimes, info.QueryTime)
+	s.queryTimes.add(info.QueryTime.QueryTime)
+	s.lockTimes.add(info.QueryTime.LockTime)
+	s.rowsSent.add(float64(info.QueryTime.RowsSent))
+	s.rowsExamined.add(float64(info.QueryTime.RowsExamined))
+	s.countQueryTime(info.QueryTime.QueryTime)
+	s.appendSeries(info.Time, info.QueryTime.QueryTime)
 
 	s.TotalQueryCount++
+
+	s.updateSeen(info.Time, info.Time)
+	s.Users = countValue(s.Users, info.User, 1)
+	s.Hosts = countValue(s.Hosts, info.Host, 1)
+	s.Databases = countValue(s.Databases, info.Database, 1)
 }
 
-func computeStatSeconds(label string, x []float64, total float64) slowQueryStatSeconds {
-	if len(x) == 0 {
-		return slowQueryStatSeconds{label: label, total: seconds(total)}
+// countQueryTime adds the query time to its bin of the histogram.
+func (s *SlowQuerySummary) countQueryTime(queryTime float64) {
+	bounds := s.bounds()
+	i := bounds.index(queryTime)
+	if i < 0 {
+		return
+	}
+	if s.queryTimeCounts == nil {
+		s.queryTimeCounts = make([]float64, len(bounds))
 	}
+	s.queryTimeCounts[i]++
+}
 
-	sort.Float64Slice(x).Sort()
+// merge adds the events of o to s.
+func (s *SlowQuerySummary) merge(o *SlowQuerySummary) {
+	s.TotalLockTime += o.TotalLockTime
+	s.TotalTime += o.TotalTime
+	s.TotalRowsSent += o.TotalRowsSent
+	s.TotalRowsExamined += o.TotalRowsExamined
+	s.queryTimes.merge(&o.queryTimes)
+	s.lockTimes.merge(&o.lockTimes)
+	s.rowsSent.merge(&o.rowsSent)
+	s.rowsExamined.merge(&o.rowsExamined)
+	for i, c := range o.queryTimeCounts {
+		if s.queryTimeCounts == nil {
+			s.queryTimeCounts = make([]float64, len(o.queryTimeCounts))
+		}
+		s.queryTimeCounts[i] += c
+	}
+	s.TotalQueryCount += o.TotalQueryCount
 
-	// var min float64
-	// for _, f := range x {
-	// 	if f > 0 {
-	// 		min = f
-	// 		break
-	// 	}
-	// }
-	min := x[0]
-	max := x[len(x)-1]
-	median := stat.Quantile(0.5, stat.Empirical, x, nil)
-	avg := total / float64(len(x))
-	stddev := stat.StdDev(x, nil)
-	quantile := stat.Quantile(0.95, stat.Empirical, x, nil)
+	s.updateSeen(o.FirstSeen, o.LastSeen)
+	for k, v := range o.Users {
+		s.Users = countValue(s.Users, k, v)
+	}
+	for k, v := range o.Hosts {
+		s.Hosts = countValue(s.Hosts, k, v)
+	}
+	for k, v := range o.Databases {
+		s.Databases = countValue(s.Databases, k, v)
+	}
+	for bucket, d := range o.series {
+		if s.series == nil {
+			s.series = make(map[int64]*distribution)
+		}
+		if prev, ok := s.series[bucket]; ok {
+			prev.merge(d)
+		} else {
+			c := d.copy()
+			s.series[bucket] = &c
+		}
+	}
+}
 
-	return slowQueryStatSeconds{
-		label:    label,
-		total:    seconds(total),
-		min:      seconds(min),
-		max:      seconds(max),
-		avg:      seconds(avg),
-		stddev:   seconds(stddev),
-		quantile: seconds(quantile),
-		median:   seconds(median),
+// snapshot returns a copy of s which is not affected by further appendQueryTime or merge calls.
+func (s *SlowQuerySummary) snapshot() *SlowQuerySummary {
+	c := *s
+	c.queryTimes = s.queryTimes.copy()
+	c.lockTimes = s.lockTimes.copy()
+	c.rowsSent = s.rowsSent.copy()
+	c.rowsExamined = s.rowsExamined.copy()
+	c.queryTimeCounts = append([]float64(nil), s.queryTimeCounts...)
+	c.Users = copyCounts(s.Users)
+	c.Hosts = copyCounts(s.Hosts)
+	c.Databases = copyCounts(s.Databases)
+	if s.series != nil {
+		c.series = make(map[int64]*distribution, len(s.series))
+		for bucket, d := range s.series {
+			dc := d.copy()
+			c.series[bucket] = &dc
+		}
 	}
+	return &c
 }
 
-func computeStatCount(label string, x []float64, total float64) slowQueryStatCount {
-	if len(x) == 0 {
-		return slowQueryStatCount{label: label, total: count(total)}
+func copyCounts(m map[string]int) map[string]int {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]int, len(m))
+	for k, v := range m {
+		c[k] = v
 	}
+	return c
+}
 
-	sort.Float64Slice(x).Sort()
+func (s *SlowQuerySummary) updateSeen(first, last time.Time) {
+	if !first.IsZero() && (s.FirstSeen.IsZero() || first.Before(s.FirstSeen)) {
+		s.FirstSeen = first
+	}
+	if last.After(s.LastSeen) {
+		s.LastSeen = last
+	}
+}
 
-	min := x[0]
-	max := x[len(x)-1]
-	median := stat.Quantile(0.5, stat.LinInterp, x, nil)
-	avg := total / float64(len(x)-1)
-	stddev := stat.StdDev(x, nil)
-	quantile := stat.Quantile(0.95, stat.LinInterp, x, nil)
+func countValue(m map[string]int, key string, n int) map[string]int {
+	if key == "" {
+		return m
+	}
+	if m == nil {
+		m = make(map[string]int)
+	}
+	m[key] += n
+	return m
+}
+
+func computeStatSeconds(label string, d *distribution, total float64, ps Percentiles) SlowQueryStatSeconds {
+	st := SlowQueryStatSeconds{
+		Label:       label,
+		Total:       Seconds(total),
+		Percentiles: ps,
+		Values:      make([]Seconds, len(ps)),
+	}
+	if d.Count == 0 {
+		return st
+	}
 
-	return slowQueryStatCount{
-		label:    label,
-		total:    count(total),
-		min:      count(min),
-		max:      count(max),
-		avg:      count(avg),
-		stddev:   count(stddev),
-		quantile: count(quantile),
-		median:   count(median),
+	st.Min = Seconds(d.Min)
+	st.Max = Seconds(d.Max)
+	st.Avg = Seconds(total / float64(d.Count))
+	st.Stddev = Seconds(d.stddev())
+	st.P95 = Seconds(d.quantile(0.95))
+	st.Median = Seconds(d.quantile(0.5))
+	for i, p := range ps {
+		st.Values[i] = Seconds(d.quantile(p / 100))
 	}
+	return st
 }
 
-type slowQueryStats struct {
-	ExecTime    slowQueryStatSeconds
-	LockTime    slowQueryStatSeconds
-	RowsSent    slowQueryStatCount
-	RowsExamine slowQueryStatCount
+// computeStatCount rounds the quantiles, since the counted values are integers.
+func computeStatCount(label string, d *distribution, total float64, ps Percentiles) SlowQueryStatCount {
+	st := SlowQueryStatCount{
+		Label:       label,
+		Total:       Count(total),
+		Percentiles: ps,
+		Values:      make([]Count, len(ps)),
+	}
+	if d.Count == 0 {
+		return st
+	}
+
+	st.Min = Count(d.Min)
+	st.Max = Count(d.Max)
+	st.Avg = Count(total / float64(d.Count))
+	st.Stddev = Count(d.stddev())
+	st.P95 = Count(math.Round(d.quantile(0.95)))
+	st.Median = Count(math.Round(d.quantile(0.5)))
+	for i, p := range ps {
+		st.Values[i] = Count(math.Round(d.quantile(p / 100)))
+	}
+	return st
 }
 
-func (s *slowQueryStats) String() string {
+type SlowQueryStats struct {
+	ExecTime    SlowQueryStatSeconds `json:"exec_time"`
+	LockTime    SlowQueryStatSeconds `json:"lock_time"`
+	RowsSent    SlowQueryStatCount   `json:"rows_sent"`
+	RowsExamine SlowQueryStatCount   `json:"rows_examined"`
+}
+
+func (s *SlowQueryStats) String() string {
 	var b strings.Builder
 	t := table.NewWriter()
 
 	t.SetOutputMirror(&b)
-	t.AppendHeader(table.Row{"Attribute", "total", "min", "max", "avg", "95%", "stddev", "median"})
+	t.AppendHeader(table.Row(s.ExecTime.percentiles().header()))
 	t.AppendRows([]table.Row{
-		{s.ExecTime.label, s.ExecTime.total, s.ExecTime.min, s.ExecTime.max, s.ExecTime.avg, s.ExecTime.quantile, s.ExecTime.stddev, s.ExecTime.median},
-		{s.LockTime.label, s.LockTime.total, s.LockTime.min, s.LockTime.max, s.LockTime.avg, s.LockTime.quantile, s.LockTime.stddev, s.LockTime.median},
-		{s.RowsSent.label, s.RowsSent.total, s.RowsSent.min, s.RowsSent.max, s.RowsSent.avg, s.RowsSent.quantile, s.RowsSent.stddev, s.RowsSent.median},
-		{s.RowsExamine.label, s.RowsExamine.total, s.RowsExamine.min, s.RowsExamine.max, s.RowsExamine.avg, s.RowsExamine.quantile, s.RowsExamine.stddev, s.RowsExamine.median},
+		s.ExecTime.row(),
+		s.LockTime.row(),
+		s.RowsSent.row(),
+		s.RowsExamine.row(),
 	})
 	t.Render()
 
 	return b.String()
 }
 
-type seconds float64
+type Seconds float64
 
-func (r seconds) String() string {
+func (r Seconds) String() string {
 	if math.IsNaN(float64(r)) || math.IsInf(float64(r), 0) {
 		return "-"
 	}
@@ -185,33 +332,171 @@ func (r seconds) String() string {
 	return fmt.Sprintf("%.0fs", r)
 }
 
-type slowQueryStatSeconds struct {
-	label    string
-	total    seconds
-	min      seconds
-	max      seconds
-	avg      seconds
-	quantile seconds
-	stddev   seconds
-	median   seconds
+func (r Seconds) MarshalJSON() ([]byte, error) {
+	return marshalFloat(float64(r))
 }
 
-type count float64
+// marshalFloat encodes NaN and Inf, e.g. the stddev of a single sample, as null.
+func marshalFloat(f float64) ([]byte, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return []byte("null"), nil
+	}
+	return json.Marshal(f)
+}
+
+type SlowQueryStatSeconds struct {
+	Label  string
+	Total  Seconds
+	Min    Seconds
+	Max    Seconds
+	Avg    Seconds
+	P95    Seconds
+	Stddev Seconds
+	Median Seconds
+	// Values are the values of Percentiles, the columns rendered by SlowQueryStats.String.
+	Percentiles Percentiles
+	Values      []Seconds
+}
+
+func (st SlowQueryStatSeconds) percentiles() Percentiles {
+	if st.Percentiles == nil {
+		return DefaultPercentiles
+	}
+	return st.Percentiles
+}
+
+func (st SlowQueryStatSeconds) values() []interface{} {
+	if st.Percentiles == nil {
+		return []interface{}{st.P95, st.Median}
+	}
+	vs := make([]interface{}, len(st.Values))
+	for i, v := range st.Values {
+		vs[i] = v
+	}
+	return vs
+}
+
+func (st SlowQueryStatSeconds) row() table.Row {
+	return statRow(st.Label, st.percentiles(), []interface{}{st.Total, st.Min, st.Max, st.Avg}, st.values(), st.Stddev)
+}
 
-func (c count) String() string {
+func (st SlowQueryStatSeconds) MarshalJSON() ([]byte, error) {
+	return marshalStat(st.percentiles(), []interface{}{st.Total, st.Min, st.Max, st.Avg}, st.values(), st.Stddev)
+}
+
+type Count float64
+
+func (c Count) String() string {
 	if math.IsNaN(float64(c)) || math.IsInf(float64(c), 0) {
 		return "-"
 	}
 	return fmt.Sprintf("%.2f", c)
 }
 
-type slowQueryStatCount struct {
-	label    string
-	total    count
-	min      count
-	max      count
-	avg      count
-	quantile count
-	stddev   count
-	median   count
+func (c Count) MarshalJSON() ([]byte, error) {
+	return marshalFloat(float64(c))
+}
+
+type SlowQueryStatCount struct {
+	Label  string
+	Total  Count
+	Min    Count
+	Max    Count
+	Avg    Count
+	P95    Count
+	Stddev Count
+	Median Count
+	// Values are the values of Percentiles, the columns rendered by SlowQueryStats.String.
+	Percentiles Percentiles
+	Values      []Count
+}
+
+func (st SlowQueryStatCount) percentiles() Percentiles {
+	if st.Percentiles == nil {
+		return DefaultPercentiles
+	}
+	return st.Percentiles
+}
+
+func (st SlowQueryStatCount) values() []interface{} {
+	if st.Percentiles == nil {
+		return []interface{}{st.P95, st.Median}
+	}
+	vs := make([]interface{}, len(st.Values))
+	for i, v := range st.Values {
+		vs[i] = v
+	}
+	return vs
+}
+
+func (st SlowQueryStatCount) row() table.Row {
+	return statRow(st.Label, st.percentiles(), []interface{}{st.Total, st.Min, st.Max, st.Avg}, st.values(), st.Stddev)
+}
+
+func (st SlowQueryStatCount) MarshalJSON() ([]byte, error) {
+	return marshalStat(st.percentiles(), []interface{}{st.Total, st.Min, st.Max, st.Avg}, st.values(), st.Stddev)
+}
+
+// statRow orders the columns like Percentiles.header: the percentiles
+// follow avg, except that the median is the last column after stddev.
+func statRow(label string, ps Percentiles, head, values []interface{}, stddev interface{}) table.Row {
+	row := append(table.Row{label}, head...)
+	var median interface{}
+	for i, p := range ps {
+		if p == 50 {
+			median = values[i]
+			continue
+		}
+		row = append(row, values[i])
+	}
+	row = append(row, stddev)
+	if median != nil {
+		row = append(row, median)
+	}
+	return row
+}
+
+// marshalStat encodes a stat as an object of total, min, max and avg, a key per
+// percentile, e.g. "p99" or "p99.9", and stddev, ordered like the table columns.
+// The median is keyed "median" like the 95th percentile is keyed "p95".
+func marshalStat(ps Percentiles, head, values []interface{}, stddev interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	field := func(key string, v interface{}) error {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%q:", key)
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		b.Write(data)
+		return nil
+	}
+	for i, key := range []string{"total", "min", "max", "avg"} {
+		if err := field(key, head[i]); err != nil {
+			return nil, err
+		}
+	}
+	var median interface{}
+	for i, p := range ps {
+		if p == 50 {
+			median = values[i]
+			continue
+		}
+		if err := field("p"+percentileKey(p), values[i]); err != nil {
+			return nil, err
+		}
+	}
+	if err := field("stddev", stddev); err != nil {
+		return nil, err
+	}
+	if median != nil {
+		if err := field("median", median); err != nil {
+			return nil, err
+		}
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
 }
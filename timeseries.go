@@ -0,0 +1,117 @@
+package querydigest
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+// TimeSeries is the activity of a summary per bucket of time. The i-th values
+// belong to the bucket starting at Start + i * Bucket.
+type TimeSeries struct {
+	Start  time.Time
+	Bucket time.Duration
+	Count  []int
+	Total  []Seconds
+	// P95 is NaN for the buckets without events.
+	P95 []Seconds
+}
+
+// maxTimeSeriesBuckets caps the length of the time series, e.g. of a month
+// of events in buckets of a second. Longer ranges are split into wider buckets.
+const maxTimeSeriesBuckets = 1440
+
+// ComputeTimeSeries fills the time series of the events from since to until,
+// so that the series of all summaries in a report share their buckets.
+// The buckets are widened to a multiple of the tracked size when the range
+// would take more than 1440 of them.
+// It is a no-op unless the Summarizer tracked time series.
+func (s *SlowQuerySummary) ComputeTimeSeries(since, until time.Time) {
+	if s.seriesBucket <= 0 || since.IsZero() {
+		return
+	}
+	size, start, n := seriesBuckets(s.seriesBucket, since, until)
+
+	ts := &TimeSeries{
+		Start:  start,
+		Bucket: size,
+		Count:  make([]int, n),
+		Total:  make([]Seconds, n),
+		P95:    make([]Seconds, n),
+	}
+	// the tracked buckets are merged into the wider ones, if any
+	dists := make([]distribution, n)
+	for bucket, d := range s.series {
+		i := int(time.Duration(bucket-start.UnixNano()) / size)
+		if i < 0 || i >= n {
+			continue
+		}
+		dists[i].merge(d)
+	}
+	for i := range dists {
+		ts.Count[i] = dists[i].Count
+		ts.Total[i] = Seconds(dists[i].Sum)
+		ts.P95[i] = Seconds(dists[i].quantile(0.95))
+	}
+	s.timeSeries = ts
+}
+
+// seriesBuckets returns the size, start and number of the buckets from since
+// to until: buckets of the given size, or of a multiple of it when the range
+// would take more than maxTimeSeriesBuckets.
+func seriesBuckets(bucket time.Duration, since, until time.Time) (time.Duration, time.Time, int) {
+	k := time.Duration(1)
+	for {
+		size := bucket * k
+		start := since.Truncate(size)
+		n := int(until.Sub(start)/size) + 1
+		if n <= maxTimeSeriesBuckets {
+			return size, start, n
+		}
+		k = max(k+1, k*time.Duration(n)/maxTimeSeriesBuckets)
+	}
+}
+
+// TimeSeries returns the time series computed by ComputeTimeSeries.
+func (s *SlowQuerySummary) TimeSeries() *TimeSeries {
+	return s.timeSeries
+}
+
+func (s *SlowQuerySummary) appendSeries(t time.Time, queryTime float64) {
+	if s.seriesBucket <= 0 || t.IsZero() {
+		return
+	}
+	if s.series == nil {
+		s.series = make(map[int64]*distribution)
+	}
+	bucket := t.Truncate(s.seriesBucket).UnixNano()
+	d, ok := s.series[bucket]
+	if !ok {
+		d = &distribution{}
+		s.series[bucket] = d
+	}
+	d.add(queryTime)
+}
+
+var sparkTicks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline draws the values relative to the largest one. Zero and NaN are
+// drawn with the lowest tick, any other value with a higher one.
+func sparkline(values []float64) string {
+	var max float64
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	var b strings.Builder
+	for _, v := range values {
+		if math.IsNaN(v) || v <= 0 || max <= 0 {
+			b.WriteRune(sparkTicks[0])
+			continue
+		}
+		i := 1 + int(math.Round(v/max*float64(len(sparkTicks)-2)))
+		b.WriteRune(sparkTicks[i])
+	}
+	return b.String()
+}
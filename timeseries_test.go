@@ -0,0 +1,107 @@
+package querydigest
+
+import (
+	"context"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAnalyze_timeSeries(t *testing.T) {
+	f, err := os.Open("./testdata/mysql-slow.timeseries.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	report, err := Analyze(context.Background(), f, WithTimeSeries(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Summaries) != 1 {
+		t.Fatalf("expect 1 summary but %d", len(report.Summaries))
+	}
+
+	ts := report.Summaries[0].TimeSeries()
+	if ts == nil {
+		t.Fatal("time series is not computed")
+	}
+	if !ts.Start.Equal(time.Date(2020, 1, 17, 5, 59, 0, 0, time.UTC)) || ts.Bucket != time.Minute {
+		t.Errorf("unexpected buckets: %s from %s", ts.Bucket, ts.Start)
+	}
+	if diff := cmp.Diff(ts.Count, []int{1, 0, 1, 0, 2}); diff != "" {
+		t.Errorf("count diff: %s", diff)
+	}
+	if diff := cmp.Diff(ts.Total, []Seconds{0.1, 0, 0.1, 0, 3}); diff != "" {
+		t.Errorf("total diff: %s", diff)
+	}
+	if !math.IsNaN(float64(ts.P95[1])) || math.Abs(float64(ts.P95[4])-2) > 2*0.01 {
+		t.Errorf("unexpected p95: %v", ts.P95)
+	}
+}
+
+func TestAnalyze_timeSeries_widened(t *testing.T) {
+	f, err := os.Open("./testdata/mysql-slow.timeseries.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	report, err := Analyze(context.Background(), f, WithTimeSeries(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := report.Summaries[0].TimeSeries()
+	if len(ts.Count) > maxTimeSeriesBuckets {
+		t.Errorf("expect at most %d buckets but %d", maxTimeSeriesBuckets, len(ts.Count))
+	}
+	if ts.Bucket <= time.Millisecond || ts.Bucket%time.Millisecond != 0 {
+		t.Errorf("expect a multiple of 1ms but %s", ts.Bucket)
+	}
+	var count int
+	var total Seconds
+	for i := range ts.Count {
+		count += ts.Count[i]
+		total += ts.Total[i]
+	}
+	if count != 4 || math.Abs(float64(total)-3.2) > 1e-9 {
+		t.Errorf("expect all events in the buckets but %d calls, %v", count, total)
+	}
+}
+
+func TestAnalyze_noTimeSeries(t *testing.T) {
+	f, err := os.Open("./testdata/mysql-slow.timeseries.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	report, err := Analyze(context.Background(), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts := report.Summaries[0].TimeSeries(); ts != nil {
+		t.Errorf("time series must not be computed unless requested: %v", ts)
+	}
+}
+
+func Test_sparkline(t *testing.T) {
+	cases := []struct {
+		values []float64
+		expect string
+	}{
+		{values: []float64{0, 1, 2, 4, 8}, expect: "▁▃▄▅█"},
+		{values: []float64{0, 0}, expect: "▁▁"},
+		{values: []float64{math.NaN(), 3}, expect: "▁█"},
+		{values: nil, expect: ""},
+	}
+	for _, c := range cases {
+		if got := sparkline(c.values); got != c.expect {
+			t.Errorf("%v: expect %s but %s", c.values, c.expect, got)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package querydigest
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// UnparsedReason is why the SQL parser did not normalize a query.
+type UnparsedReason string
+
+const (
+	// UnparsedUnsupported is a statement the parser does not support, e.g.
+	// SHOW or BEGIN, which is fingerprinted token by token.
+	UnparsedUnsupported UnparsedReason = "unsupported statement"
+	// UnparsedTokenizerError is a query which could not be split into tokens,
+	// e.g. with an unterminated string, which is fingerprinted lexically.
+	UnparsedTokenizerError UnparsedReason = "tokenizer error"
+	// UnparsedParserError is a supported statement with a syntax the parser
+	// does not understand, which is fingerprinted token by token.
+	UnparsedParserError UnparsedReason = "parser error"
+	// UnparsedPanic is a query the parser panicked on.
+	UnparsedPanic UnparsedReason = "panic"
+)
+
+var unparsedReasons = []UnparsedReason{UnparsedUnsupported, UnparsedTokenizerError, UnparsedParserError, UnparsedPanic}
+
+// maxUnparsedExamples is the number of examples kept per reason.
+const maxUnparsedExamples = 3
+
+// maxExampleLength truncates the examples, e.g. of bulk inserts.
+const maxExampleLength = 200
+
+// UnparsedQueries are the queries the SQL parser did not normalize for Reason.
+// They are still digested under their fallback fingerprint, but e.g. IN lists
+// may not be collapsed and their tables are not resolved.
+type UnparsedQueries struct {
+	Reason    UnparsedReason
+	Count     int
+	QueryTime float64
+	Examples  []UnparsedExample
+}
+
+type UnparsedExample struct {
+	Query string `json:"query"`
+	Error string `json:"error"`
+}
+
+type unparsedCollector struct {
+	mu       sync.Mutex
+	byReason map[UnparsedReason]*UnparsedQueries
+}
+
+func (c *unparsedCollector) add(reason UnparsedReason, s *SlowQueryInfo, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.byReason == nil {
+		c.byReason = make(map[UnparsedReason]*UnparsedQueries)
+	}
+	u, ok := c.byReason[reason]
+	if !ok {
+		u = &UnparsedQueries{Reason: reason}
+		c.byReason[reason] = u
+	}
+	u.Count++
+	u.QueryTime += s.QueryTime.QueryTime
+	if len(u.Examples) < maxUnparsedExamples {
+		u.Examples = append(u.Examples, UnparsedExample{Query: truncateExample(string(s.RawQuery)), Error: err.Error()})
+	}
+}
+
+// truncateExample cuts q to maxExampleLength bytes, on a rune boundary.
+func truncateExample(q string) string {
+	if len(q) <= maxExampleLength {
+		return q
+	}
+	n := maxExampleLength
+	for n > 0 && !utf8.RuneStart(q[n]) {
+		n--
+	}
+	return q[:n] + "..."
+}
+
+// queries returns a copy of the collected queries in the order of unparsedReasons.
+func (c *unparsedCollector) queries() []*UnparsedQueries {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var out []*UnparsedQueries
+	for _, reason := range unparsedReasons {
+		if u, ok := c.byReason[reason]; ok {
+			cp := *u
+			cp.Examples = append([]UnparsedExample(nil), u.Examples...)
+			out = append(out, &cp)
+		}
+	}
+	return out
+}
+
+func printUnparsed(w io.Writer, report *Report) {
+	fmt.Fprintln(w, "Unparsed queries:")
+	for _, u := range report.Unparsed {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "%s\t%d queries\t%0.6fs\t%0.2f%% of the query time\n",
+			u.Reason, u.Count, u.QueryTime, ptPercent(u.QueryTime, report.TotalQueryTime))
+		for _, e := range u.Examples {
+			fmt.Fprintf(w, "  %s\n", strings.Join(strings.Fields(e.Query), " "))
+			fmt.Fprintf(w, "    %s\n", e.Error)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package querydigest
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAnalyze_unparsed(t *testing.T) {
+	r := analyzeFile(t, "./testdata/mysql-slow.unparsable.log")
+
+	type unparsed struct {
+		Reason    UnparsedReason
+		Count     int
+		QueryTime float64
+		Examples  int
+	}
+	var got []unparsed
+	for _, u := range r.Unparsed {
+		got = append(got, unparsed{Reason: u.Reason, Count: u.Count, QueryTime: u.QueryTime, Examples: len(u.Examples)})
+	}
+	expect := []unparsed{
+		{Reason: UnparsedUnsupported, Count: 1, QueryTime: 0.0005, Examples: 1},
+		{Reason: UnparsedTokenizerError, Count: 2, QueryTime: 0.000326, Examples: 2},
+		{Reason: UnparsedParserError, Count: 1, QueryTime: 0.25, Examples: 1},
+		{Reason: UnparsedPanic, Count: 1, QueryTime: 0.0004, Examples: 1},
+	}
+	if diff := cmp.Diff(got, expect); diff != "" {
+		t.Errorf("diff: %s", diff)
+	}
+	if e := r.Unparsed[2].Examples[0]; e.Query != "ALTER TABLE items ADD INDEX idx_category (category_id);" || e.Error == "" {
+		t.Errorf("unexpected example: %+v", e)
+	}
+
+	var text bytes.Buffer
+	if err := r.Write(&text, FormatText); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text.String(), "parser error\t1 queries\t0.250000s\t99.39% of the query time\n") {
+		t.Errorf("unexpected text output: %s", text.String())
+	}
+
+	var out bytes.Buffer
+	if err := r.Write(&out, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Unparsed []struct {
+			Reason   string `json:"reason"`
+			Count    int    `json:"count"`
+			Examples []struct {
+				Query string `json:"query"`
+			} `json:"examples"`
+		} `json:"unparsed"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Unparsed) != 4 || decoded.Unparsed[1].Reason != "tokenizer error" || len(decoded.Unparsed[1].Examples) != 2 {
+		t.Errorf("unexpected json: %+v", decoded.Unparsed)
+	}
+
+	if r := analyzeFile(t, "./testdata/mysql-slow.unparsable.log", WithFingerprint(FingerprintLexical)); len(r.Unparsed) != 0 {
+		t.Errorf("expect no unparsed queries in lexical mode but %+v", r.Unparsed)
+	}
+}
+
+func Test_truncateExample(t *testing.T) {
+	short := "SELECT 'ソファー';"
+	if got := truncateExample(short); got != short {
+		t.Errorf("expect %q but %q", short, got)
+	}
+	long := "INSERT INTO t VALUES ('x" + strings.Repeat("ソファー", 30) + "');"
+	got := truncateExample(long)
+	if !utf8.ValidString(got) || !strings.HasSuffix(got, "...") || len(got) > maxExampleLength+len("...") {
+		t.Errorf("unexpected truncation: %q", got)
+	}
+	if !strings.HasPrefix(long, strings.TrimSuffix(got, "...")) {
+		t.Errorf("expect a prefix of the query but %q", got)
+	}
+}
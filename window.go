@@ -0,0 +1,137 @@
+package querydigest
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Window is the digest of the events whose time is in [Start, End).
+type Window struct {
+	Start time.Time
+	End   time.Time
+	// Summaries are sorted by total time, or like Report.Summaries in Report.Windows.
+	Summaries       []*SlowQuerySummary
+	TotalQueryTime  float64
+	TotalQueryCount int
+	// UniqueQueries is the number of digests before a limit was applied.
+	UniqueQueries int
+}
+
+// WindowedSummarizer buckets the events by their time into fixed windows, e.g.
+// of 5 minutes, and summarizes each window separately.
+//
+// A window is emitted once an event newer than the end of the following window
+// is collected, so events may arrive out of order by up to one window. An older
+// event, e.g. of another log, reopens its window, which is emitted again with
+// the late events only; they are counted by Late.
+type WindowedSummarizer struct {
+	size        time.Duration
+	groupBy     GroupBy
+	percentiles Percentiles
+	bounds      HistogramBounds
+	emit        func(*Window)
+	mu          sync.Mutex
+	windows     map[time.Time]*Summarizer
+	watermark   time.Time
+	emitted     time.Time
+	late        int
+}
+
+// NewWindowedSummarizer returns a WindowedSummarizer which calls emit with
+// every completed window in the order of time. emit is called while the
+// summarizer is locked, so it must not call the summarizer.
+func NewWindowedSummarizer(size time.Duration, groupBy GroupBy, emit func(*Window)) *WindowedSummarizer {
+	return &WindowedSummarizer{
+		size:    size,
+		groupBy: groupBy,
+		emit:    emit,
+		windows: make(map[time.Time]*Summarizer),
+	}
+}
+
+// SetPercentiles sets the percentiles computed in the stats of the emitted windows.
+func (w *WindowedSummarizer) SetPercentiles(ps Percentiles) {
+	w.mu.Lock()
+	w.percentiles = ps
+	w.mu.Unlock()
+}
+
+// SetHistogramBounds sets the bins of the histograms of the windows. It must be called before Collect.
+func (w *WindowedSummarizer) SetHistogramBounds(b HistogramBounds) {
+	w.bounds = b
+}
+
+// Collect adds the event to the window of its time. Events without time are ignored.
+func (w *WindowedSummarizer) Collect(i *SlowQueryInfo) {
+	if i.Time.IsZero() {
+		return
+	}
+	start := i.Time.Truncate(w.size)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if start.Before(w.emitted) {
+		w.late++
+	}
+	s, ok := w.windows[start]
+	if !ok {
+		s = NewGroupedSummarizer(w.groupBy)
+		s.percentiles = w.percentiles
+		s.SetHistogramBounds(w.bounds)
+		w.windows[start] = s
+	}
+	s.Collect(i)
+
+	if i.Time.After(w.watermark) {
+		w.watermark = i.Time
+		w.emitBefore(w.watermark.Add(-w.size))
+	}
+}
+
+// Flush emits every remaining window, e.g. at the end of the log.
+func (w *WindowedSummarizer) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.emitBefore(time.Time{})
+}
+
+// Late returns the number of events collected after their window was emitted.
+func (w *WindowedSummarizer) Late() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.late
+}
+
+// emitBefore emits the windows which end at or before t, or all of them when t is zero.
+func (w *WindowedSummarizer) emitBefore(t time.Time) {
+	var starts []time.Time
+	for start := range w.windows {
+		if t.IsZero() || !start.Add(w.size).After(t) {
+			starts = append(starts, start)
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool {
+		return starts[i].Before(starts[j])
+	})
+
+	for _, start := range starts {
+		s := w.windows[start]
+		delete(w.windows, start)
+		end := start.Add(w.size)
+		if end.After(w.emitted) {
+			w.emitted = end
+		}
+
+		summaries := s.Summarize()
+		w.emit(&Window{
+			Start:           start,
+			End:             end,
+			Summaries:       summaries,
+			TotalQueryTime:  s.TotalQueryTime(),
+			TotalQueryCount: s.TotalQueryCount(),
+			UniqueQueries:   len(summaries),
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package querydigest
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWindowedSummarizer(t *testing.T) {
+	base := time.Date(2020, 1, 17, 6, 0, 0, 0, time.UTC)
+	event := func(offset time.Duration, query string) *SlowQueryInfo {
+		return &SlowQueryInfo{
+			ParsedQuery: query,
+			RawQuery:    []byte(query),
+			Time:        base.Add(offset),
+			QueryTime:   QueryTime{QueryTime: 1},
+		}
+	}
+
+	type window struct {
+		Start time.Duration
+		Count int
+		Items []string
+	}
+	var got []window
+	w := NewWindowedSummarizer(time.Minute, defaultGroupBy, func(win *Window) {
+		var items []string
+		for _, s := range win.Summaries {
+			items = append(items, s.Fingerprint)
+		}
+		got = append(got, window{Start: win.Start.Sub(base), Count: win.TotalQueryCount, Items: items})
+	})
+
+	w.Collect(event(10*time.Second, "a"))
+	w.Collect(event(70*time.Second, "b"))
+	// out of order by less than a window
+	w.Collect(event(50*time.Second, "b"))
+	w.Collect(event(0, "a"))
+	if len(got) != 0 {
+		t.Fatalf("windows must not be emitted within the grace period: %v", got)
+	}
+
+	// completes the first window
+	w.Collect(event(121*time.Second, "c"))
+	// late for the emitted window
+	w.Collect(event(30*time.Second, "a"))
+	// no event in the third minute
+	w.Collect(event(4*time.Minute, "a"))
+	w.Collect(&SlowQueryInfo{ParsedQuery: "no time", QueryTime: QueryTime{QueryTime: 1}})
+	w.Flush()
+
+	expect := []window{
+		{Start: 0, Count: 3, Items: []string{"a", "b"}},
+		// reopened by the late event
+		{Start: 0, Count: 1, Items: []string{"a"}},
+		{Start: time.Minute, Count: 1, Items: []string{"b"}},
+		{Start: 2 * time.Minute, Count: 1, Items: []string{"c"}},
+		{Start: 4 * time.Minute, Count: 1, Items: []string{"a"}},
+	}
+	if diff := cmp.Diff(got, expect); diff != "" {
+		t.Errorf("diff: %s", diff)
+	}
+	if w.Late() != 1 {
+		t.Errorf("expect 1 late event but %d", w.Late())
+	}
+}
+
+func TestAnalyze_window(t *testing.T) {
+	// the second log is older, so its events arrive after their window was emitted
+	var sources []Source
+	for _, name := range []string{"./testdata/mysql-slow.percona.log", "./testdata/mysql-slow.group.log", "./testdata/mysql-slow.header.log"} {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		sources = append(sources, Source{Name: name, Reader: f})
+	}
+
+	report, err := AnalyzeSources(context.Background(), sources, WithWindow(time.Minute), WithLimit(1), WithConcurrency(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	for i, win := range report.Windows {
+		count += win.TotalQueryCount
+		if len(win.Summaries) > 1 {
+			t.Errorf("summaries of a window must be limited: %d", len(win.Summaries))
+		}
+		if win.End.Sub(win.Start) != time.Minute {
+			t.Errorf("unexpected window: %s - %s", win.Start, win.End)
+		}
+		if i > 0 && !report.Windows[i-1].Start.Before(win.Start) {
+			t.Errorf("windows must be unique and in the order of time: %s, %s", report.Windows[i-1].Start, win.Start)
+		}
+	}
+	if len(report.Windows) != 2 || count != report.TotalQueryCount {
+		t.Errorf("every event must be in a window: %d windows, %d of %d events", len(report.Windows), count, report.TotalQueryCount)
+	}
+}